@@ -1,97 +1,269 @@
 package bootstrap
 
 import (
+	"context"
 	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/config/policy"
 	_ "github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/health"
 	"github.com/liuliliujian/go-infra-com/transport/http/ginhttp"
 	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc"
+	"github.com/liuliliujian/go-infra-com/util/graceutil"
 	"github.com/liuliliujian/go-infra-com/util/stackutil"
-	"flag"
+	"fmt"
 	errs "github.com/pkg/errors"
-	"github.com/spf13/pflag"
 	"go.uber.org/zap"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
+type Options struct {
+	ShutdownTimeout time.Duration `default:"30s" min:"1s"`
+	DrainPeriod     time.Duration `min:"0s"` //收到退出信号后先报告not ready, 等待负载均衡摘除流量后再停止组件
+	UpgradeTimeout  time.Duration `default:"1m" min:"1s"` //平滑升级时等待新进程ready的超时时间
+}
+
 func init() {
-	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
-	pflag.Parse()
+	config.RegisterSchema(config.CONF_APP_PREF, Options{})
+}
+
+func NewOptions(c config.Config) (*Options, error) {
+	o := &Options{}
+	if err := config.Bind(c, config.CONF_APP_PREF, o); err != nil {
+		return nil, err
+	}
+	return o, nil
 }
 
 type Application struct {
 	logger     *zap.Logger
+	options    *Options
+	status     *health.Status
 	HttpServer *ginhttp.Server
 	RpcServer  *microrpc.Server
+	components Components
+	hooks      ShutdownHooks
 }
 
-func NewApp(c config.Config, logger *zap.Logger, httpServer *ginhttp.Server, rpcServer *microrpc.Server) (*Application, error) {
+func NewComponentApp(c config.Config, logger *zap.Logger, status *health.Status, components Components, hooks ShutdownHooks) (*Application, error) {
+	o, err := NewOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	//拼写错误的配置项会被忽略, config.strict为true时启动失败
+	unknown, err := config.CheckUnknownKeys(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range unknown {
+		logger.Warn("unknown config key is ignored", zap.String("key", key))
+	}
+	if err := policy.Enforce(c, logger); err != nil {
+		return nil, err
+	}
+	admin, err := newAdminComponent(c, logger)
+	if err != nil {
+		return nil, err
+	}
+	if admin != nil {
+		components = append(Components{*admin}, components...)
+	}
+	sorted, err := sortComponents(components)
+	if err != nil {
+		return nil, errs.WithMessage(err, "invalid application components")
+	}
+	//停止配置的后台监听
+	if closer, ok := c.(io.Closer); ok {
+		hooks = append(hooks, ShutdownHook{Name: "config", Func: func(ctx context.Context) error {
+			return closer.Close()
+		}})
+	}
 	if c.GetBool(config.CONF_STACKDUMP) {
-		stackutil.SetupStackDumper(stackutil.ZapLogger{logger})
+		stackutil.SetupStackDumper(stackutil.ZapLogger{Logger: logger})
 	}
 	return &Application{
 		logger:     logger,
-		HttpServer: httpServer,
-		RpcServer:  rpcServer,
+		options:    o,
+		status:     status,
+		components: sorted,
+		hooks:      hooks,
 	}, nil
 }
 
-func RunApp(c config.Config, logger *zap.Logger, httpServer *ginhttp.Server, rpcServer *microrpc.Server) (*Application, error) {
-	app, err := NewApp(c, logger, httpServer, rpcServer)
+func RunComponentApp(c config.Config, logger *zap.Logger, status *health.Status, components Components, hooks ShutdownHooks) (*Application, error) {
+	app, err := NewComponentApp(c, logger, status, components, hooks)
+	if err != nil {
+		return nil, err
+	}
+	return app, app.Start(context.Background())
+}
+
+//hooks为额外的shutdown hooks, 例如gormdb.NewShutdownHook, 没有时使用NoShutdownHooks
+func NewApp(c config.Config, logger *zap.Logger, status *health.Status, httpServer *ginhttp.Server, rpcServer *microrpc.Server, hooks ShutdownHooks) (*Application, error) {
+	components := make(Components, 0, 2)
+	if httpServer != nil {
+		components = append(components, HttpComponent(httpServer))
+	}
+	if rpcServer != nil {
+		components = append(components, RpcComponent(rpcServer))
+	}
+	app, err := NewComponentApp(c, logger, status, components, hooks)
+	if err != nil {
+		return nil, err
+	}
+	app.HttpServer = httpServer
+	app.RpcServer = rpcServer
+	return app, nil
+}
+
+func RunApp(c config.Config, logger *zap.Logger, status *health.Status, httpServer *ginhttp.Server, rpcServer *microrpc.Server, hooks ShutdownHooks) (*Application, error) {
+	app, err := NewApp(c, logger, status, httpServer, rpcServer, hooks)
 	if err != nil {
 		return nil, err
 	}
-	return app, app.Start()
+	return app, app.Start(context.Background())
+}
+
+func NewHttpApp(c config.Config, logger *zap.Logger, status *health.Status, httpServer *ginhttp.Server, hooks ShutdownHooks) (*Application, error) {
+	return NewApp(c, logger, status, httpServer, nil, hooks)
 }
 
-func NewHttpApp(c config.Config, logger *zap.Logger, httpServer *ginhttp.Server) (*Application, error) {
-	return NewApp(c, logger, httpServer, nil)
+func RunHttpApp(c config.Config, logger *zap.Logger, status *health.Status, httpServer *ginhttp.Server, hooks ShutdownHooks) (*Application, error) {
+	return RunApp(c, logger, status, httpServer, nil, hooks)
 }
 
-func RunHttpApp(c config.Config, logger *zap.Logger, httpServer *ginhttp.Server) (*Application, error) {
-	return RunApp(c, logger, httpServer, nil)
+func NewRpcApp(c config.Config, logger *zap.Logger, status *health.Status, rpcServer *microrpc.Server, hooks ShutdownHooks) (*Application, error) {
+	return NewApp(c, logger, status, nil, rpcServer, hooks)
 }
 
-func NewRpcApp(c config.Config, logger *zap.Logger, rpcServer *microrpc.Server) (*Application, error) {
-	return NewApp(c, logger, nil, rpcServer)
+func RunRpcApp(c config.Config, logger *zap.Logger, status *health.Status, rpcServer *microrpc.Server, hooks ShutdownHooks) (*Application, error) {
+	return RunApp(c, logger, status, nil, rpcServer, hooks)
 }
 
-func RunRpcApp(c config.Config, logger *zap.Logger, rpcServer *microrpc.Server) (*Application, error) {
-	return RunApp(c, logger, nil, rpcServer)
+func (a *Application) Components() Components {
+	return a.components
 }
 
-func (a *Application) Start() error {
-	if a.HttpServer != nil {
-		if err := a.HttpServer.Start(); err != nil {
-			return errs.WithMessage(err, "failed to start http server")
+//全部启动或全部回滚: 某个组件启动失败时, 已启动的组件按逆序停止
+func (a *Application) Start(ctx context.Context) error {
+	for i, component := range a.components {
+		if err := component.Lifecycle.Start(ctx); err != nil {
+			a.logger.Error(fmt.Sprintf("failed to start component[%s], rollback started components", component.Name), zap.Error(err))
+			err = a.rollback(a.components[:i], component.Name, err)
+			a.transit(health.StateStopped)
+			return err
 		}
 	}
+	a.transit(health.StateReady)
+	if graceutil.IsUpgrading() {
+		a.logger.Info("notify parent process that upgrade is ready")
+	}
+	if err := graceutil.NotifyReady(); err != nil {
+		a.logger.Warn("failed to notify parent process that upgrade is ready", zap.Error(err))
+	}
+	return nil
+}
 
-	if a.RpcServer != nil {
-		if err := a.RpcServer.Start(); err != nil {
-			return errs.WithMessage(err, "failed to start rpc server")
+func (a *Application) rollback(started Components, failed string, cause error) error {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), a.options.ShutdownTimeout)
+	defer cancelFunc()
+
+	startErr := &StartError{Component: failed, Err: cause}
+	var errors multiError
+	for i := len(started) - 1; i >= 0; i-- {
+		component := started[i]
+		if err := component.Lifecycle.Stop(ctx); err != nil {
+			a.logger.Warn(fmt.Sprintf("failed to rollback component[%s]", component.Name), zap.Error(err))
+			errors = append(errors, errs.WithMessage(err, fmt.Sprintf("failed to rollback component[%s]", component.Name)))
+			continue
 		}
+		startErr.RolledBack = append(startErr.RolledBack, component.Name)
 	}
-	return nil
+	startErr.RollbackErr = errors.ErrorOrNil()
+	return startErr
 }
 
-func (a *Application) WaitShutdown() {
+//按启动的逆序停止, 单个组件停止失败不影响其余组件
+func (a *Application) Stop(ctx context.Context) error {
+	var errors multiError
+	for i := len(a.components) - 1; i >= 0; i-- {
+		component := a.components[i]
+		if err := component.Lifecycle.Stop(ctx); err != nil {
+			a.logger.Warn(fmt.Sprintf("failed to stop component[%s]", component.Name), zap.Error(err))
+			errors = append(errors, errs.WithMessage(err, fmt.Sprintf("failed to stop component[%s]", component.Name)))
+		}
+	}
+	return errors.ErrorOrNil()
+}
+
+//阻塞直到收到退出信号或ctx结束, 然后执行Shutdown, 由调用方根据返回的error决定退出码
+//收到graceutil.UpgradeSignal时启动新进程接管listener, 新进程ready后当前进程直接Shutdown, 不经过drain:
+//listener与新进程共享, drain期间当前进程仍会accept并报告not ready, 健康检查会在两个进程间随机失败,
+//而Shutdown先关闭当前进程持有的listener(新进程继续监听), 再等待处理中的请求完成
+func (a *Application) Run(ctx context.Context) error {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
-	select {
-	case s := <-c:
-		a.logger.Info("receive shutdown signal", zap.String("signal", s.String()))
-		if a.HttpServer != nil {
-			if err := a.HttpServer.Stop(); err != nil {
-				a.logger.Warn("failed to stop http server", zap.Error(err))
+	defer signal.Stop(c)
+	upgrade := make(chan os.Signal, 1)
+	signal.Notify(upgrade, graceutil.UpgradeSignal)
+	defer signal.Stop(upgrade)
+	upgraded := false
+wait:
+	for {
+		select {
+		case s := <-c:
+			a.logger.Info("receive shutdown signal", zap.String("signal", s.String()))
+			break wait
+		case <-ctx.Done():
+			a.logger.Info("application context done", zap.Error(ctx.Err()))
+			break wait
+		case s := <-upgrade:
+			a.logger.Info("receive upgrade signal", zap.String("signal", s.String()))
+			if err := graceutil.Upgrade(a.options.UpgradeTimeout); err != nil {
+				a.logger.Error("failed to upgrade, keep serving", zap.Error(err))
+				continue
 			}
+			a.logger.Info("succeed to upgrade, shutdown old process")
+			upgraded = true
+			break wait
 		}
-		if a.RpcServer != nil {
-			if err := a.RpcServer.Stop(); err != nil {
-				a.logger.Warn("failed to stop rpc server", zap.Error(err))
-			}
-		}
-		os.Exit(0)
 	}
+	if !upgraded {
+		a.drain(c)
+	}
+	return a.Shutdown()
+}
+
+//报告not ready并等待drain period, 期间再次收到退出信号则立即结束等待
+func (a *Application) drain(c <-chan os.Signal) {
+	a.transit(health.StateDraining)
+	if a.options.DrainPeriod <= 0 {
+		return
+	}
+	a.logger.Info(fmt.Sprintf("draining traffic for %v before shutdown", a.options.DrainPeriod))
+	select {
+	case s := <-c:
+		a.logger.Info("receive shutdown signal again, skip draining", zap.String("signal", s.String()))
+	case <-time.After(a.options.DrainPeriod):
+	}
+}
+
+func (a *Application) transit(state health.State) {
+	if err := a.status.Transit(state); err != nil {
+		a.logger.Warn("failed to transit application state", zap.Error(err))
+		return
+	}
+	a.logger.Info(fmt.Sprintf("application state: %s", state))
+}
+
+func (a *Application) State() health.State {
+	return a.status.State()
+}
+
+//Deprecated: 使用Run, os.Exit会跳过main中的defer
+func (a *Application) WaitShutdown() {
+	os.Exit(ExitCode(a.Run(context.Background())))
 }
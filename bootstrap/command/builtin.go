@@ -0,0 +1,317 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/bootstrap"
+	"github.com/liuliliujian/go-infra-com/buildinfo"
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/config/policy"
+	"github.com/liuliliujian/go-infra-com/config/vipercfg"
+	"github.com/liuliliujian/go-infra-com/database/gormdb"
+	"github.com/liuliliujian/go-infra-com/health"
+	"github.com/liuliliujian/go-infra-com/log/zaplog"
+	"github.com/liuliliujian/go-infra-com/transport/http/adminhttp"
+	"github.com/liuliliujian/go-infra-com/transport/http/ginhttp"
+	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc"
+	errs "github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func serveCommand(o Options) *Command {
+	return &Command{
+		Name:  "serve",
+		Usage: "start the application (default command)",
+		Run: func(ctx context.Context, args []string) error {
+			if o.Serve == nil {
+				return errors.New("serve function is not supplied")
+			}
+			app, err := o.Serve()
+			if err != nil {
+				return err
+			}
+			//NewApp生成的injector只创建应用, 由serve启动; RunApp已启动(ready)时不再重复启动
+			if app.State() == health.StateStarting {
+				if err := app.Start(ctx); err != nil {
+					return err
+				}
+			}
+			return app.Run(ctx)
+		},
+	}
+}
+
+func configCommand(o Options) *Command {
+	var (
+		format       string
+		sources      bool
+		schemaFormat string
+	)
+	return &Command{
+		Name:  "config",
+		Usage: "inspect configuration",
+		Subcommands: []*Command{
+			{
+				Name:  "print",
+				Usage: "print the merged configuration with sensitive values redacted",
+				Flags: func(flags *pflag.FlagSet) {
+					flags.StringVar(&format, "format", "yaml", "output format: yaml/json")
+					flags.BoolVar(&sources, "sources", false, "print each key with its source: flag/env/file/etcd/default")
+				},
+				Run: func(ctx context.Context, args []string) error {
+					c, err := vipercfg.New()
+					if err != nil {
+						return err
+					}
+					defer closeConfig(c)
+					if sources {
+						return printValue(config.DisplaySources(c), format)
+					}
+					return printValue(config.DisplaySettings(c), format)
+				},
+			},
+			{
+				Name:  "encrypt",
+				Usage: "encrypt a value as ENC(...) with the key from env " + config.ENV_SECRET_KEY + " or " + config.ENV_SECRET_KEY_FILE + ", read from stdin if no argument",
+				Run: func(ctx context.Context, args []string) error {
+					key, err := config.LoadSecretKey()
+					if err != nil {
+						return err
+					}
+					var value string
+					if len(args) > 0 {
+						value = args[0]
+					} else {
+						in, err := ioutil.ReadAll(stdin)
+						if err != nil {
+							return err
+						}
+						value = strings.TrimRight(string(in), "\r\n")
+					}
+					encrypted, err := config.Encrypt(key, value)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintln(stdout, encrypted)
+					return nil
+				},
+			},
+			{
+				Name:  "schema",
+				Usage: "print the reference of registered config options as json schema or markdown",
+				Flags: func(flags *pflag.FlagSet) {
+					flags.StringVar(&schemaFormat, "format", "json", "output format: json/markdown")
+				},
+				Run: func(ctx context.Context, args []string) error {
+					switch schemaFormat {
+					case "json":
+						return printValue(config.JSONSchema(), "json")
+					case "markdown", "md":
+						fmt.Fprint(stdout, config.SchemaMarkdown())
+						return nil
+					}
+					return errors.New(fmt.Sprintf("unsupported format[%s], only support: json/markdown", schemaFormat))
+				},
+			},
+			{
+				Name:  "validate",
+				Usage: "validate the configuration of built-in modules, registered validators and environment policies",
+				Run: func(ctx context.Context, args []string) error {
+					c, err := vipercfg.New()
+					if err != nil {
+						return err
+					}
+					defer closeConfig(c)
+					invalids := validate(c, o.Validators)
+					unknown, err := config.CheckUnknownKeys(c)
+					if err != nil {
+						invalids = append(invalids, err)
+					} else {
+						for _, key := range unknown {
+							fmt.Fprintf(stderr, "warning: unknown config key[%s] is ignored\n", key)
+						}
+					}
+					violations, err := policy.Check(c)
+					if err != nil {
+						invalids = append(invalids, err)
+					}
+					for _, violation := range violations {
+						if violation.Level == policy.LEVEL_FAIL {
+							invalids = append(invalids, errors.New("config policy violated: "+violation.String()))
+							continue
+						}
+						fmt.Fprintf(stderr, "warning: config policy violated: %s\n", violation)
+					}
+					if len(invalids) > 0 {
+						for _, err := range invalids {
+							fmt.Fprintln(stderr, err)
+						}
+						return errors.New(fmt.Sprintf("config is invalid, %d error(s) found", len(invalids)))
+					}
+					fmt.Fprintln(stdout, "config is valid")
+					return nil
+				},
+			},
+		},
+	}
+}
+
+//一次性命令不需要监听配置变更
+func closeConfig(c config.Config) {
+	if closer, ok := c.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func validate(c config.Config, validators []func(c config.Config) error) []error {
+	logger := zap.NewNop()
+	builtins := []func(c config.Config) error{
+		func(c config.Config) error { _, err := bootstrap.NewOptions(c); return err },
+		func(c config.Config) error { _, err := health.NewOptions(c); return err },
+		func(c config.Config) error { _, err := adminhttp.NewOptions(c); return err },
+		func(c config.Config) error { _, err := zaplog.NewOptions(c); return err },
+	}
+	if c.IsSet("gin") {
+		builtins = append(builtins, func(c config.Config) error { _, err := ginhttp.NewOptions(c); return err })
+	}
+	if c.IsSet("micro") {
+		builtins = append(builtins, func(c config.Config) error { _, err := microrpc.NewOptions(c, logger); return err })
+	}
+	if c.IsSet("db") {
+		builtins = append(builtins, func(c config.Config) error { _, err := gormdb.NewOptions(c, logger); return err })
+	}
+
+	var errors []error
+	for _, validator := range append(builtins, validators...) {
+		if err := validator(c); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	return errors
+}
+
+func migrateCommand(o Options) *Command {
+	return &Command{
+		Name:  "migrate",
+		Usage: "run database migrations",
+		Run: func(ctx context.Context, args []string) error {
+			if o.Migrate == nil {
+				return errors.New("no migration registered")
+			}
+			c, err := vipercfg.New()
+			if err != nil {
+				return err
+			}
+			defer closeConfig(c)
+			zapOptions, err := zaplog.NewOptions(c)
+			if err != nil {
+				return err
+			}
+			logger, err := zaplog.New(zapOptions)
+			if err != nil {
+				return err
+			}
+			defer zaplog.Close(logger)
+			healthOptions, err := health.NewOptions(c)
+			if err != nil {
+				return err
+			}
+			dbOptions, err := gormdb.NewOptions(c, logger)
+			if err != nil {
+				return err
+			}
+			db, err := gormdb.New(dbOptions, logger, health.NewRegistry(healthOptions))
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			if err := o.Migrate(db); err != nil {
+				return errs.WithMessage(err, "failed to migrate database")
+			}
+			logger.Info("succeed to migrate database")
+			return nil
+		},
+	}
+}
+
+//探测本机运行中实例的readiness, 可用于容器的HEALTHCHECK
+func healthcheckCommand() *Command {
+	var (
+		url     string
+		timeout time.Duration
+	)
+	return &Command{
+		Name:  "healthcheck",
+		Usage: "probe the readiness of a running instance",
+		Flags: func(flags *pflag.FlagSet) {
+			flags.StringVar(&url, "url", "", "readiness url, default http://127.0.0.1:{gin.port}/health/ready")
+			flags.DurationVar(&timeout, "timeout", 3*time.Second, "probe timeout")
+		},
+		Run: func(ctx context.Context, args []string) error {
+			if url == "" {
+				c, err := vipercfg.New()
+				if err != nil {
+					return err
+				}
+				defer closeConfig(c)
+				o, err := ginhttp.NewOptions(c)
+				if err != nil {
+					return err
+				}
+				url = fmt.Sprintf("http://127.0.0.1:%d/health/ready", o.Port)
+			}
+			client := &http.Client{Timeout: timeout}
+			resp, err := client.Get(url)
+			if err != nil {
+				return errs.WithMessage(err, "failed to probe instance")
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			fmt.Fprintln(stdout, string(body))
+			if resp.StatusCode != http.StatusOK {
+				return errors.New(fmt.Sprintf("instance is not ready, status code: %d", resp.StatusCode))
+			}
+			return nil
+		},
+	}
+}
+
+func versionCommand() *Command {
+	return &Command{
+		Name:  "version",
+		Usage: "print version information",
+		Run: func(ctx context.Context, args []string) error {
+			fmt.Fprintln(stdout, buildinfo.Get())
+			return nil
+		},
+	}
+}
+
+func printValue(v interface{}, format string) error {
+	switch format {
+	case "json":
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(out))
+	case "yaml":
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(stdout, string(out))
+	default:
+		return errors.New(fmt.Sprintf("unsupported format[%s], only support: yaml/json", format))
+	}
+	return nil
+}
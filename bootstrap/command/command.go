@@ -0,0 +1,185 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/liuliliujian/go-infra-com/bootstrap"
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+	命令行入口, 取代import时的pflag.Parse:
+		app [command [subcommand]] [flags] [args]
+	未指定command时执行serve, 兼容原有的启动方式
+*/
+type Command struct {
+	Name        string
+	Usage       string
+	Flags       func(flags *pflag.FlagSet) //子命令自身的flag, 不会绑定到配置中
+	Run         func(ctx context.Context, args []string) error
+	Subcommands []*Command
+}
+
+type Options struct {
+	Serve      func() (*bootstrap.Application, error) //wire生成的injector, 使用NewApp或RunApp均可, 未启动的应用由serve启动
+	Migrate    func(db *gorm.DB) error
+	Validators []func(c config.Config) error //config validate时追加执行的业务校验
+	Commands   []*Command                    //自定义命令
+}
+
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+//解析命令行并执行, 返回进程退出码
+func Execute(o Options) int {
+	err := execute(context.Background(), newRoot(o), os.Args[1:])
+	if err == pflag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return bootstrap.ExitCode(err)
+	}
+	return 0
+}
+
+func newRoot(o Options) *Command {
+	root := &Command{
+		Name: filepath.Base(os.Args[0]),
+		Subcommands: []*Command{
+			serveCommand(o),
+			configCommand(o),
+			migrateCommand(o),
+			healthcheckCommand(),
+			versionCommand(),
+		},
+	}
+	root.Subcommands = append(root.Subcommands, o.Commands...)
+	root.Subcommands = append(root.Subcommands, &Command{
+		Name:  "help",
+		Usage: "show usage",
+		Run: func(ctx context.Context, args []string) error {
+			printUsage(root, root)
+			return nil
+		},
+	})
+	return root
+}
+
+func execute(ctx context.Context, root *Command, args []string) error {
+	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	cmd, args, unknown := resolve(root, args)
+	if cmd == root {
+		if unknown != "" {
+			printUsage(root, root)
+			return errors.New(fmt.Sprintf("unknown command[%s]", unknown))
+		}
+		cmd = root.subcommand("serve")
+	}
+	if cmd.Run == nil {
+		printUsage(root, cmd)
+		return errors.New(fmt.Sprintf("command[%s] requires a subcommand", cmd.Name))
+	}
+
+	//全局flag(config, env等)与子命令flag合并解析, 全局flag的值仍记录在pflag.CommandLine中供配置读取
+	flags := pflag.NewFlagSet(cmd.Name, pflag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.AddFlagSet(pflag.CommandLine)
+	if cmd.Flags != nil {
+		cmd.Flags(flags)
+	}
+	flags.Usage = func() {
+		printUsage(root, cmd)
+		fmt.Fprintln(stderr, "\nFlags:")
+		fmt.Fprint(stderr, flags.FlagUsages())
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	pflag.CommandLine.Parse(nil)
+	return cmd.Run(ctx, flags.Args())
+}
+
+//跳过全局flag查找命令, 例如 app --config x config print, 返回命令、去掉命令名后的参数及root下无法识别的命令
+//子命令自身的flag需写在子命令之后
+func resolve(root *Command, args []string) (*Command, []string, string) {
+	cmd := root
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			if takesValue(arg) && i+1 < len(args) {
+				i++
+				rest = append(rest, args[i])
+			}
+			continue
+		}
+		sub := cmd.subcommand(arg)
+		if sub == nil {
+			rest = append(rest, args[i:]...)
+			if cmd == root {
+				return cmd, rest, arg
+			}
+			break
+		}
+		cmd = sub
+	}
+	return cmd, rest, ""
+}
+
+//全局flag以"--name value"的形式传值时, 下一个参数是flag的值而不是命令
+func takesValue(arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+	var f *pflag.Flag
+	if strings.HasPrefix(arg, "--") {
+		f = pflag.CommandLine.Lookup(arg[2:])
+	} else if len(arg) == 2 {
+		f = pflag.CommandLine.ShorthandLookup(arg[1:])
+	}
+	return f != nil && f.NoOptDefVal == ""
+}
+
+func (c *Command) subcommand(name string) *Command {
+	for _, sub := range c.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+func printUsage(root *Command, cmd *Command) {
+	if cmd == root {
+		fmt.Fprintf(stderr, "Usage: %s [command] [flags]\n\nCommands:\n", root.Name)
+	} else {
+		fmt.Fprintf(stderr, "Usage: %s %s [flags]\n", root.Name, cmd.Name)
+		if cmd.Usage != "" {
+			fmt.Fprintf(stderr, "\n%s\n", cmd.Usage)
+		}
+		if len(cmd.Subcommands) == 0 {
+			return
+		}
+		fmt.Fprintln(stderr, "\nCommands:")
+	}
+	for _, sub := range cmd.Subcommands {
+		fmt.Fprintf(stderr, "  %-16s %s\n", sub.Name, sub.Usage)
+	}
+}
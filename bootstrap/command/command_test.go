@@ -0,0 +1,114 @@
+package command
+
+import (
+	"context"
+	"github.com/liuliliujian/go-infra-com/bootstrap"
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/config/vipercfg"
+	"github.com/liuliliujian/go-infra-com/health"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	root := newRoot(Options{})
+	cases := []struct {
+		args    []string
+		command string
+		rest    []string
+		unknown string
+	}{
+		{[]string{"config", "print", "--format", "json"}, "print", []string{"--format", "json"}, ""},
+		{[]string{"--config", "app.yml", "config", "print"}, "print", []string{"--config", "app.yml"}, ""},
+		{[]string{"--env=prod", "config", "print", "--sources"}, "print", []string{"--env=prod", "--sources"}, ""},
+		{[]string{"config", "encrypt", "secret"}, "encrypt", []string{"secret"}, ""},
+		{[]string{"--config", "app.yml"}, root.Name, []string{"--config", "app.yml"}, ""},
+		{[]string{"--config", "app.yml", "unknown"}, root.Name, []string{"--config", "app.yml", "unknown"}, "unknown"},
+		{[]string{"--", "config"}, root.Name, []string{"--", "config"}, ""},
+	}
+	for _, c := range cases {
+		cmd, rest, unknown := resolve(root, c.args)
+		if cmd.Name != c.command || !reflect.DeepEqual(rest, c.rest) || unknown != c.unknown {
+			t.Errorf("args %v: expect %s %v [%s], but got %s %v [%s]", c.args, c.command, c.rest, c.unknown, cmd.Name, rest, unknown)
+		}
+	}
+}
+
+func TestExecuteGlobalFlagBeforeCommand(t *testing.T) {
+	origin := stderr
+	stderr = ioutil.Discard
+	defer func() { stderr = origin }()
+	defer pflag.CommandLine.Set(config.CONF_FILE, "")
+	var (
+		args   []string
+		output string
+	)
+	root := newRoot(Options{Commands: []*Command{{
+		Name: "echo",
+		Subcommands: []*Command{{
+			Name:  "args",
+			Flags: func(flags *pflag.FlagSet) { flags.StringVar(&output, "output", "", "") },
+			Run: func(ctx context.Context, a []string) error {
+				args = a
+				return nil
+			},
+		}},
+	}}})
+	if err := execute(context.Background(), root, []string{"--config", "app.yml", "echo", "args", "--output", "o", "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(args, []string{"a"}) || output != "o" {
+		t.Fatalf("expect args [a] and output o, but got %v %s", args, output)
+	}
+	if file, _ := pflag.CommandLine.GetString(config.CONF_FILE); file != "app.yml" {
+		t.Fatalf("expect global flag parsed, but got %s", file)
+	}
+	if err := execute(context.Background(), root, []string{"--config", "app.yml", "unknown"}); err == nil {
+		t.Fatal("expect error for unknown command")
+	}
+}
+
+type countLifecycle struct {
+	starts, stops int
+}
+
+func (l *countLifecycle) Start(ctx context.Context) error {
+	l.starts++
+	return nil
+}
+
+func (l *countLifecycle) Stop(ctx context.Context) error {
+	l.stops++
+	return nil
+}
+
+func TestServeStartsApp(t *testing.T) {
+	c, err := vipercfg.NewFromSettings(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, create := range []func(config.Config, *zap.Logger, *health.Status, bootstrap.Components, bootstrap.ShutdownHooks) (*bootstrap.Application, error){
+		bootstrap.NewComponentApp,
+		bootstrap.RunComponentApp,
+	} {
+		lifecycle := &countLifecycle{}
+		var app *bootstrap.Application
+		root := newRoot(Options{Serve: func() (*bootstrap.Application, error) {
+			var err error
+			app, err = create(c, zap.NewNop(), health.NewStatus(), bootstrap.Components{{Name: "counter", Lifecycle: lifecycle}}, nil)
+			return app, err
+		}})
+		//ctx结束后Run立即shutdown
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := execute(ctx, root, []string{"serve"}); err != nil {
+			t.Fatal(err)
+		}
+		if lifecycle.starts != 1 || lifecycle.stops != 1 || app.State() != health.StateStopped {
+			t.Fatalf("expect started once and stopped, but got %d starts %d stops %s", lifecycle.starts, lifecycle.stops, app.State())
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/transport/http/adminhttp"
+	"github.com/liuliliujian/go-infra-com/transport/http/ginhttp"
+	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc"
+	"go.uber.org/zap"
+)
+
+const (
+	COMPONENT_ADMIN = "admin"
+	COMPONENT_HTTP  = "http"
+	COMPONENT_RPC   = "rpc"
+)
+
+//由Application统一管理启停的组件, 例如http/rpc server, mq consumer, job scheduler等
+type Lifecycle interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+type Component struct {
+	Name      string
+	Lifecycle Lifecycle
+	DependsOn []string //被依赖的组件先启动, 后停止
+}
+
+//通过wire提供, 例如:
+//	func NewComponents(h *ginhttp.Server, consumer *Consumer) bootstrap.Components {
+//		return bootstrap.Components{bootstrap.HttpComponent(h), {Name: "consumer", Lifecycle: consumer}}
+//	}
+type Components []Component
+
+func HttpComponent(s *ginhttp.Server) Component {
+	return Component{Name: COMPONENT_HTTP, Lifecycle: s}
+}
+
+func RpcComponent(s *microrpc.Server) Component {
+	return Component{Name: COMPONENT_RPC, Lifecycle: s}
+}
+
+//根据application.admin配置创建, 未启用时返回nil, 最先启动以便排查其余组件的启停问题
+func newAdminComponent(c config.Config, logger *zap.Logger) (*Component, error) {
+	o, err := adminhttp.NewOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	if !o.Enabled {
+		return nil, nil
+	}
+	s, err := adminhttp.NewServer(o, logger, c)
+	if err != nil {
+		return nil, err
+	}
+	return &Component{Name: COMPONENT_ADMIN, Lifecycle: s}, nil
+}
+
+//组件启动失败, 包含回滚结果
+type StartError struct {
+	Component   string
+	Err         error
+	RolledBack  []string
+	RollbackErr error
+}
+
+func (e *StartError) Error() string {
+	msg := fmt.Sprintf("failed to start component[%s]: %v; rolled back components: %v", e.Component, e.Err, e.RolledBack)
+	if e.RollbackErr != nil {
+		msg += "; " + e.RollbackErr.Error()
+	}
+	return msg
+}
+
+func (e *StartError) Cause() error {
+	return e.Err
+}
+
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+//按依赖关系排序, 无依赖关系的组件保持注册顺序
+func sortComponents(components Components) (Components, error) {
+	index := make(map[string]int, len(components))
+	for i, component := range components {
+		if component.Name == "" {
+			return nil, errors.New("component's name is required")
+		}
+		if component.Lifecycle == nil {
+			return nil, errors.New(fmt.Sprintf("component[%s]'s lifecycle is required", component.Name))
+		}
+		if _, ok := index[component.Name]; ok {
+			return nil, errors.New(fmt.Sprintf("duplicate component[%s]", component.Name))
+		}
+		index[component.Name] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make([]int, len(components))
+	sorted := make(Components, 0, len(components))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		component := components[i]
+		switch marks[i] {
+		case visited:
+			return nil
+		case visiting:
+			return errors.New(fmt.Sprintf("circular component dependency: %v", append(path, component.Name)))
+		}
+		marks[i] = visiting
+		for _, dep := range component.DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				return errors.New(fmt.Sprintf("component[%s] depends on unknown component[%s]", component.Name, dep))
+			}
+			if err := visit(j, append(path, component.Name)); err != nil {
+				return err
+			}
+		}
+		marks[i] = visited
+		sorted = append(sorted, component)
+		return nil
+	}
+	for i := range components {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
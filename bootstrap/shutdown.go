@@ -0,0 +1,113 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/health"
+	"github.com/liuliliujian/go-infra-com/log/zaplog"
+	errs "github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const defaultHookTimeout = 5 * time.Second
+
+//应用退出前按注册顺序执行, 例如关闭db连接池, 断开broker连接
+type ShutdownHook struct {
+	Name    string
+	Timeout time.Duration //单个hook的超时时间, 默认5s, 同时受整体shutdown deadline约束
+	Func    func(ctx context.Context) error
+}
+
+type ShutdownHooks []ShutdownHook
+
+//没有额外shutdown hook时提供给wire
+func NoShutdownHooks() ShutdownHooks {
+	return nil
+}
+
+func (a *Application) OnShutdown(hooks ...ShutdownHook) {
+	a.hooks = append(a.hooks, hooks...)
+}
+
+//在整体deadline内停止所有组件并执行shutdown hooks, logger最后sync
+func (a *Application) Shutdown() error {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), a.options.ShutdownTimeout)
+	defer cancelFunc()
+
+	var errors multiError
+	if err := a.Stop(ctx); err != nil {
+		errors = append(errors, err)
+	}
+	a.transit(health.StateStopped)
+
+	hooks := make(ShutdownHooks, 0, len(a.hooks)+1)
+	hooks = append(hooks, a.hooks...)
+	hooks = append(hooks, ShutdownHook{
+		Name: "logger",
+		Func: func(ctx context.Context) error {
+			return zaplog.Close(a.logger)
+		},
+	})
+	for _, hook := range hooks {
+		if err := a.runHook(ctx, hook); err != nil {
+			a.logger.Warn(fmt.Sprintf("failed to run shutdown hook[%s]", hook.Name), zap.Error(err))
+			errors = append(errors, errs.WithMessage(err, fmt.Sprintf("failed to run shutdown hook[%s]", hook.Name)))
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		errors = append(errors, errs.New(fmt.Sprintf("shutdown deadline(%v) exceeded", a.options.ShutdownTimeout)))
+	}
+	return errors.ErrorOrNil()
+}
+
+func (a *Application) runHook(ctx context.Context, hook ShutdownHook) error {
+	if hook.Func == nil {
+		return nil
+	}
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancelFunc := context.WithTimeout(ctx, timeout)
+	defer cancelFunc()
+
+	//hook未响应ctx时也不阻塞后续hook
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.Func(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errs.WithMessage(ctx.Err(), fmt.Sprintf("timeout(%v) waiting for shutdown hook", timeout))
+	}
+}
+
+//0: 正常退出, 1: 启动或退出过程中出现错误
+func ExitCode(err error) int {
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+type multiError []error
+
+func (m multiError) Error() string {
+	messages := make([]string, 0, len(m))
+	for _, err := range m {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (m multiError) ErrorOrNil() error {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
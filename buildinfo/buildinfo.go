@@ -0,0 +1,68 @@
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+/*
+	构建信息, 通过ldflags注入, 未注入时从runtime/debug.ReadBuildInfo获取:
+	go build -ldflags "-X github.com/liuliliujian/go-infra-com/buildinfo.version=v1.0.0 \
+		-X github.com/liuliliujian/go-infra-com/buildinfo.commit=$(git rev-parse --short HEAD) \
+		-X github.com/liuliliujian/go-infra-com/buildinfo.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+*/
+var (
+	version   string
+	commit    string
+	buildTime string
+)
+
+const unknown = "unknown"
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+	Module    string `json:"module,omitempty"`
+}
+
+func Get() Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Module = bi.Main.Path
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+	}
+	if info.Version == "" {
+		info.Version = unknown
+	}
+	if info.Commit == "" {
+		info.Commit = unknown
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = unknown
+	}
+	return info
+}
+
+//用于注册中心metadata等只支持字符串的场景
+func (i Info) Map() map[string]string {
+	return map[string]string{
+		"version":    i.Version,
+		"commit":     i.Commit,
+		"build_time": i.BuildTime,
+		"go_version": i.GoVersion,
+	}
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("version: %s\ncommit: %s\nbuild time: %s\ngo: %s", i.Version, i.Commit, i.BuildTime, i.GoVersion)
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	errs "github.com/pkg/errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TAG_DEFAULT  = "default"  //默认值, []string以逗号分隔
+	TAG_REQUIRED = "required" //"true"时不能为零值
+	TAG_MIN      = "min"      //数值/Duration的下限, string/slice/map的最小长度
+	TAG_MAX      = "max"      //数值/Duration的上限, string/slice/map的最大长度
+	TAG_ONEOF    = "oneof"    //以空格分隔的可选值, 忽略大小写, 空字符串不校验
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+//单个配置项的校验错误
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Key + " " + e.Message
+}
+
+//汇总所有不合法的配置项
+type BindError struct {
+	Key    string
+	Fields []FieldError
+}
+
+func (e *BindError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		msgs = append(msgs, field.Error())
+	}
+	return fmt.Sprintf("invalid %s config options: %s", e.Key, strings.Join(msgs, "; "))
+}
+
+//将key下的配置绑定到obj(struct或slice的指针), 根据字段tag设置默认值并校验:
+//	type Options struct {
+//		Port    int           `default:"9090" min:"1" max:"59999"`
+//		Mode    string        `default:"debug" oneof:"debug test release"`
+//		URL     string        `required:"true"`
+//		Timeout time.Duration `default:"10s" min:"1s"`
+//	}
+//默认值只设置给零值字段, 调用方可预先赋值; slice元素的默认值在读取配置后补充
+//nil的struct指针字段会被创建, 配置为空值(例如只写了micro.client:)时同样创建并设置默认值, 配置项路径使用首字母小写的字段名或mapstructure tag
+func Bind(c Config, key string, obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New(fmt.Sprintf("bind target of config[%s] must be a non-nil pointer", key))
+	}
+	b := &binder{}
+	b.defaults(v.Elem(), key)
+	if len(b.errors) == 0 {
+		if err := c.UnmarshalKey(key, obj); err != nil {
+			return errs.WithMessage(err, fmt.Sprintf("invalid %s config options", key))
+		}
+		b.validate(v.Elem(), key)
+	}
+	if len(b.errors) > 0 {
+		return &BindError{Key: key, Fields: b.errors}
+	}
+	return nil
+}
+
+type binder struct {
+	errors []FieldError
+}
+
+func (b *binder) fail(key string, format string, args ...interface{}) {
+	b.errors = append(b.errors, FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (b *binder) defaults(v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() && v.Type().Elem().Kind() == reflect.Struct {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if !v.IsNil() {
+			b.defaults(v.Elem(), path)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field, ok := fieldOf(t.Field(i))
+			if !ok {
+				continue
+			}
+			fv := v.Field(i)
+			key := path + "." + field.key
+			if def, ok := field.tag.Lookup(TAG_DEFAULT); ok && isZero(fv) {
+				if err := parseInto(fv, def); err != nil {
+					b.fail(key, "has invalid default[%s]: %v", def, err)
+				}
+			}
+			b.defaults(fv, key)
+		}
+	}
+}
+
+func (b *binder) validate(v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		//空值的配置段被mapstructure设置为nil
+		if v.IsNil() && v.Type().Elem().Kind() == reflect.Struct {
+			b.defaults(v, path)
+		}
+		if !v.IsNil() {
+			b.validate(v.Elem(), path)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			key := fmt.Sprintf("%s[%d]", path, i)
+			b.defaults(elem, key)
+			b.validate(elem, key)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field, ok := fieldOf(t.Field(i))
+			if !ok {
+				continue
+			}
+			fv := v.Field(i)
+			key := path + "." + field.key
+			b.check(fv, key, field.tag)
+			if fv.Kind() == reflect.Struct || fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Slice {
+				b.validate(fv, key)
+			}
+		}
+	}
+}
+
+func (b *binder) check(v reflect.Value, key string, tag reflect.StructTag) {
+	if tag.Get(TAG_REQUIRED) == "true" && isZero(v) {
+		b.fail(key, "is required")
+		return
+	}
+	if min, ok := tag.Lookup(TAG_MIN); ok {
+		if cmp, err := compare(v, min); err != nil {
+			b.fail(key, "has invalid min[%s]: %v", min, err)
+		} else if cmp < 0 {
+			b.fail(key, "must be >= %s, but got %s", min, display(v))
+		}
+	}
+	if max, ok := tag.Lookup(TAG_MAX); ok {
+		if cmp, err := compare(v, max); err != nil {
+			b.fail(key, "has invalid max[%s]: %v", max, err)
+		} else if cmp > 0 {
+			b.fail(key, "must be <= %s, but got %s", max, display(v))
+		}
+	}
+	if oneof, ok := tag.Lookup(TAG_ONEOF); ok && v.Kind() == reflect.String && v.String() != "" {
+		options := strings.Fields(oneof)
+		for _, option := range options {
+			if strings.EqualFold(option, v.String()) {
+				return
+			}
+		}
+		b.fail(key, "must be one of %v, but got [%s]", options, v.String())
+	}
+}
+
+type bindField struct {
+	key string
+	tag reflect.StructTag
+}
+
+func fieldOf(f reflect.StructField) (bindField, bool) {
+	if f.PkgPath != "" {
+		return bindField{}, false
+	}
+	name := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+	if name == "-" {
+		return bindField{}, false
+	}
+	if name == "" {
+		name = lowerCamel(f.Name)
+	}
+	return bindField{key: name, tag: f.Tag}, true
+}
+
+//URL -> url, FilePath -> filePath, 与配置文件中的写法一致
+func lowerCamel(name string) string {
+	runes := []rune(name)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] < 'A' || runes[i] > 'Z' {
+			break
+		}
+		if i > 0 && i+1 < len(runes) && (runes[i+1] < 'A' || runes[i+1] > 'Z') {
+			break
+		}
+		runes[i] = runes[i] + ('a' - 'A')
+	}
+	return string(runes)
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func parseInto(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		bv, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(bv)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		iv, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(iv)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		uv, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(uv)
+	case reflect.Float32, reflect.Float64:
+		fv, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(fv)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errors.New(fmt.Sprintf("unsupported default type %v", v.Type()))
+		}
+		parts := strings.Split(s, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		v.Set(reflect.ValueOf(parts).Convert(v.Type()))
+	default:
+		return errors.New(fmt.Sprintf("unsupported default type %v", v.Type()))
+	}
+	return nil
+}
+
+//返回v与边界值bound的比较结果, string/slice/map比较长度
+func compare(v reflect.Value, bound string) (int, error) {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(bound)
+		if err != nil {
+			return 0, err
+		}
+		return compareFloat(float64(v.Int()), float64(d)), nil
+	}
+	var actual float64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = v.Float()
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		actual = float64(v.Len())
+	default:
+		return 0, errors.New(fmt.Sprintf("unsupported type %v", v.Type()))
+	}
+	f, err := strconv.ParseFloat(bound, 64)
+	if err != nil {
+		return 0, err
+	}
+	return compareFloat(actual, f), nil
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func display(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return fmt.Sprintf("length %d", v.Len())
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
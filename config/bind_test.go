@@ -0,0 +1,52 @@
+package config_test
+
+import (
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/mitchellh/mapstructure"
+	"testing"
+	"time"
+)
+
+//按mapstructure ZeroFields解码, 空值的配置段会把指针设置为nil
+type zeroFieldsConfig struct {
+	config.Config
+	settings map[string]interface{}
+}
+
+func (c *zeroFieldsConfig) UnmarshalKey(key string, obj interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:     obj,
+		ZeroFields: true,
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(c.settings[key])
+}
+
+type clientOptions struct {
+	Timeout     time.Duration `default:"10s" min:"1ms"`
+	Loadbalance string        `default:"random" oneof:"random roundrobin"`
+}
+
+type bindOptions struct {
+	Registry string `required:"true"`
+	Client   *clientOptions
+}
+
+func TestBindEmptyPointerSection(t *testing.T) {
+	c := &zeroFieldsConfig{settings: map[string]interface{}{
+		"micro": map[string]interface{}{"registry": "memory", "client": nil},
+	}}
+	o := &bindOptions{}
+	if err := config.Bind(c, "micro", o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Client == nil {
+		t.Fatal("expect empty section allocated")
+	}
+	if o.Client.Timeout != 10*time.Second || o.Client.Loadbalance != "random" {
+		t.Fatalf("expect defaults for empty section, but got %+v", o.Client)
+	}
+}
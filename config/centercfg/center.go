@@ -0,0 +1,370 @@
+/*
+配置中心客户端, 按namespace获取配置并通过long-polling监听变更, 由vipercfg在配置了config.center.url时使用
+
+	config:
+	  center:
+	    url: http://config-center:8080
+	    namespaces: [application.yml, db.yml]
+
+协议:
+	GET {url}/configs/{app}/{env}/{namespace}
+		200 {"version": "12", "content": "..."}, content的格式由namespace的扩展名决定, 默认yaml
+	GET {url}/notifications?app={app}&env={env}&namespaces={namespace}:{version},...&timeout={seconds}
+		有变更时立即返回 200 [{"namespace": "db.yml", "version": "13"}]
+		timeout内无变更返回 304
+配置了token时请求携带 Authorization: Bearer {token}
+*/
+package centercfg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/config"
+	errs "github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const CONF_CENTER = "config.center"
+
+type Options struct {
+	URL           string        `required:"true"`
+	App           string        //默认application.name
+	Env           string        //默认运行环境
+	Namespaces    []string      `default:"application.yml" min:"1"` //排在后面的namespace优先
+	Format        string        `default:"yaml"`                    //namespace没有扩展名时的格式
+	Token         string
+	PollTimeout   time.Duration `default:"60s" min:"1s"` //long-polling的等待时间
+	RetryInterval time.Duration `default:"5s" min:"100ms"`
+	SnapshotDir   string        `default:"config-snapshot"` //本地快照目录, 配置中心不可用时从快照启动
+}
+
+func init() {
+	config.RegisterSchema(CONF_CENTER, Options{})
+}
+
+func NewOptions(c config.Config) (*Options, error) {
+	o := &Options{
+		App: config.GetApplicationName(c),
+		Env: config.GetEnvironment(c),
+	}
+	if err := config.Bind(c, CONF_CENTER, o); err != nil {
+		return nil, err
+	}
+	if o.App == "" {
+		return nil, errors.New(fmt.Sprintf("%s.app or %s is required", CONF_CENTER, config.CONF_APPNAME))
+	}
+	o.URL = strings.TrimRight(o.URL, "/")
+	return o, nil
+}
+
+//单个namespace的配置
+type Namespace struct {
+	Name     string
+	Version  string
+	Settings map[string]interface{}
+}
+
+type namespaceContent struct {
+	Version string `json:"version"`
+	Content string `json:"content"`
+}
+
+type notification struct {
+	Namespace string `json:"namespace"`
+	Version   string `json:"version"`
+}
+
+type Client struct {
+	options    *Options
+	http       *http.Client
+	snapshot   *config.Snapshot
+	mu         sync.Mutex
+	contents   map[string]namespaceContent
+	namespaces map[string]*Namespace
+	snapshotAt time.Time //从快照加载时为快照的保存时间
+}
+
+//httpClient为nil时使用不带超时的默认client, 每个请求的超时由context控制
+func NewClient(o *Options, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	name := fmt.Sprintf("center-%s-%s.json", o.App, o.Env)
+	return &Client{
+		options:    o,
+		http:       httpClient,
+		snapshot:   config.NewSnapshot(filepath.Join(o.SnapshotDir, name)),
+		contents:   make(map[string]namespaceContent),
+		namespaces: make(map[string]*Namespace),
+	}
+}
+
+//获取所有namespace, 配置中心不可用时从本地快照加载, 两者都失败时返回错误
+func (c *Client) Load(ctx context.Context) error {
+	err := c.fetchAll(ctx)
+	if err == nil {
+		return nil
+	}
+	contents := make(map[string]namespaceContent)
+	savedAt, snapshotErr := c.snapshot.Load(&contents)
+	if snapshotErr != nil {
+		return errs.WithMessage(err, fmt.Sprintf("config center is unavailable and %v", snapshotErr))
+	}
+	if err := c.apply(contents); err != nil {
+		return errs.WithMessage(err, "invalid config snapshot")
+	}
+	c.mu.Lock()
+	c.snapshotAt = savedAt
+	c.mu.Unlock()
+	config.Log(zapcore.WarnLevel, "config center is unavailable, started from snapshot",
+		zap.String("snapshot", c.snapshot.Path()), zap.Time("savedAt", savedAt), zap.Error(err))
+	return nil
+}
+
+//是否从本地快照加载及快照的保存时间, 配置中心恢复后变为false
+func (c *Client) FromSnapshot() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshotAt, !c.snapshotAt.IsZero()
+}
+
+func (c *Client) SnapshotPath() string {
+	return c.snapshot.Path()
+}
+
+//按Options.Namespaces的顺序返回
+func (c *Client) Namespaces() []Namespace {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	namespaces := make([]Namespace, 0, len(c.options.Namespaces))
+	for _, name := range c.options.Namespaces {
+		if namespace, ok := c.namespaces[name]; ok {
+			namespaces = append(namespaces, *namespace)
+		}
+	}
+	return namespaces
+}
+
+//long-polling监听变更直到ctx结束, 变更生效后回调onChange, 请求失败时按RetryInterval重试
+func (c *Client) Watch(ctx context.Context, onChange func()) {
+	for {
+		changed, err := c.poll(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			config.Log(zapcore.WarnLevel, "failed to poll config center", zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(c.options.RetryInterval):
+			}
+			continue
+		}
+		if changed {
+			onChange()
+		}
+	}
+}
+
+//从快照启动时先获取全部配置, 否则等待变更通知并获取变更的namespace
+func (c *Client) poll(ctx context.Context) (bool, error) {
+	if _, ok := c.FromSnapshot(); ok {
+		before := c.versions()
+		if err := c.fetchAll(ctx); err != nil {
+			return false, err
+		}
+		config.Log(zapcore.InfoLevel, "config center is available again, switched from snapshot", zap.String("snapshot", c.snapshot.Path()))
+		return !equalVersions(before, c.versions()), nil
+	}
+
+	versions := c.versions()
+	pairs := make([]string, 0, len(c.options.Namespaces))
+	for _, name := range c.options.Namespaces {
+		pairs = append(pairs, name+":"+versions[name])
+	}
+	query := url.Values{}
+	query.Set("app", c.options.App)
+	query.Set("env", c.options.Env)
+	query.Set("namespaces", strings.Join(pairs, ","))
+	query.Set("timeout", fmt.Sprint(int(c.options.PollTimeout/time.Second)))
+	var notifications []notification
+	status, err := c.get(ctx, "/notifications?"+query.Encode(), c.options.PollTimeout+10*time.Second, &notifications)
+	if err != nil || status == http.StatusNotModified {
+		return false, err
+	}
+
+	contents := c.currentContents()
+	changed := false
+	for _, n := range notifications {
+		if n.Version != "" && n.Version == versions[n.Namespace] {
+			continue
+		}
+		if _, ok := contents[n.Namespace]; !ok {
+			continue
+		}
+		content, err := c.fetch(ctx, n.Namespace)
+		if err != nil {
+			return false, err
+		}
+		contents[n.Namespace] = content
+		changed = changed || content.Version != versions[n.Namespace]
+	}
+	if !changed {
+		return false, nil
+	}
+	if err := c.commit(contents); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *Client) fetchAll(ctx context.Context) error {
+	contents := make(map[string]namespaceContent, len(c.options.Namespaces))
+	for _, name := range c.options.Namespaces {
+		content, err := c.fetch(ctx, name)
+		if err != nil {
+			return err
+		}
+		contents[name] = content
+	}
+	return c.commit(contents)
+}
+
+//生效并保存快照, 快照保存失败不影响配置生效
+func (c *Client) commit(contents map[string]namespaceContent) error {
+	if err := c.apply(contents); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.snapshotAt = time.Time{}
+	c.mu.Unlock()
+	if err := c.snapshot.Save(contents); err != nil {
+		config.Log(zapcore.WarnLevel, "failed to save config center snapshot", zap.Error(err))
+	}
+	return nil
+}
+
+//解析所有namespace后整体替换
+func (c *Client) apply(contents map[string]namespaceContent) error {
+	namespaces := make(map[string]*Namespace, len(contents))
+	for _, name := range c.options.Namespaces {
+		content, ok := contents[name]
+		if !ok {
+			return errors.New(fmt.Sprintf("config center namespace[%s] is missing", name))
+		}
+		settings, err := c.parse(name, content.Content)
+		if err != nil {
+			return err
+		}
+		namespaces[name] = &Namespace{Name: name, Version: content.Version, Settings: settings}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.contents = contents
+	c.namespaces = namespaces
+	return nil
+}
+
+func (c *Client) parse(name string, content string) (map[string]interface{}, error) {
+	format := c.options.Format
+	if ext := filepath.Ext(name); ext != "" {
+		format = ext[1:]
+	}
+	v := viper.New()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(bytes.NewReader([]byte(content))); err != nil {
+		return nil, errs.WithMessage(err, fmt.Sprintf("invalid config center namespace[%s]", name))
+	}
+	return v.AllSettings(), nil
+}
+
+func (c *Client) fetch(ctx context.Context, name string) (namespaceContent, error) {
+	var content namespaceContent
+	path := fmt.Sprintf("/configs/%s/%s/%s", url.PathEscape(c.options.App), url.PathEscape(c.options.Env), url.PathEscape(name))
+	status, err := c.get(ctx, path, 10*time.Second, &content)
+	if err != nil {
+		return content, err
+	}
+	if status != http.StatusOK {
+		return content, errors.New(fmt.Sprintf("config center namespace[%s] is not found", name))
+	}
+	return content, nil
+}
+
+//返回状态码, 200时将body解析到result
+func (c *Client) get(ctx context.Context, path string, timeout time.Duration, result interface{}) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, c.options.URL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	if c.options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.options.Token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, errs.WithMessage(err, "failed to request config center")
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, errs.WithMessage(err, "failed to read config center response")
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.Unmarshal(body, result); err != nil {
+			return 0, errs.WithMessage(err, "invalid config center response")
+		}
+		return resp.StatusCode, nil
+	case http.StatusNotModified, http.StatusNotFound:
+		return resp.StatusCode, nil
+	}
+	return 0, errors.New(fmt.Sprintf("config center responded %d: %s", resp.StatusCode, strings.TrimSpace(string(body))))
+}
+
+func (c *Client) versions() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	versions := make(map[string]string, len(c.namespaces))
+	for name, namespace := range c.namespaces {
+		versions[name] = namespace.Version
+	}
+	return versions
+}
+
+func (c *Client) currentContents() map[string]namespaceContent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	contents := make(map[string]namespaceContent, len(c.contents))
+	for name, content := range c.contents {
+		contents[name] = content
+	}
+	return contents
+}
+
+func equalVersions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package centercfg
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+//配置中心的stand-in, 按namespace保存版本与内容, notifications按请求顺序返回预设的响应
+type stubCenter struct {
+	mu            sync.Mutex
+	contents      map[string]namespaceContent
+	notifications []func(w http.ResponseWriter)
+	polls         int
+}
+
+func newStubCenter() *stubCenter {
+	return &stubCenter{contents: map[string]namespaceContent{
+		"application.yml": {Version: "1", Content: "app:\n  name: demo\n  port: 8080\n"},
+	}}
+}
+
+func (s *stubCenter) set(namespace string, content namespaceContent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contents[namespace] = content
+}
+
+func (s *stubCenter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.URL.Path == "/notifications":
+		if s.polls < len(s.notifications) {
+			s.notifications[s.polls](w)
+		} else {
+			w.WriteHeader(http.StatusNotModified)
+		}
+		s.polls++
+	case r.URL.Path == "/configs/demo/test/application.yml":
+		json.NewEncoder(w).Encode(s.contents["application.yml"])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "centercfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func newTestClient(url string, dir string) *Client {
+	return NewClient(&Options{
+		URL:           url,
+		App:           "demo",
+		Env:           "test",
+		Namespaces:    []string{"application.yml"},
+		Format:        "yaml",
+		Token:         "secret",
+		PollTimeout:   time.Second,
+		RetryInterval: 10 * time.Millisecond,
+		SnapshotDir:   dir,
+	}, nil)
+}
+
+func settings(t *testing.T, c *Client) map[string]interface{} {
+	namespaces := c.Namespaces()
+	if len(namespaces) != 1 {
+		t.Fatalf("expect 1 namespace, but got %d", len(namespaces))
+	}
+	return namespaces[0].Settings["app"].(map[string]interface{})
+}
+
+func TestLoad(t *testing.T) {
+	server := httptest.NewServer(newStubCenter())
+	defer server.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	c := newTestClient(server.URL, dir)
+	if err := c.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.FromSnapshot(); ok {
+		t.Fatal("expect loaded from config center")
+	}
+	if name := settings(t, c)["name"]; name != "demo" {
+		t.Fatalf("expect app.name demo, but got %v", name)
+	}
+	if version := c.Namespaces()[0].Version; version != "1" {
+		t.Fatalf("expect version 1, but got %s", version)
+	}
+	if _, err := os.Stat(c.SnapshotPath()); err != nil {
+		t.Fatalf("expect snapshot saved: %v", err)
+	}
+}
+
+func TestLoadFromSnapshotAndRecover(t *testing.T) {
+	center := newStubCenter()
+	server := httptest.NewServer(center)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	c := newTestClient(server.URL, dir)
+	if err := c.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	//配置中心不可用时从快照启动
+	down := NewClient(c.options, nil)
+	if err := down.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := down.FromSnapshot(); !ok {
+		t.Fatal("expect loaded from snapshot")
+	}
+	if name := settings(t, down)["name"]; name != "demo" {
+		t.Fatalf("expect app.name demo from snapshot, but got %v", name)
+	}
+
+	//配置中心恢复后获取全部配置并切换到配置中心
+	center.set("application.yml", namespaceContent{Version: "2", Content: "app:\n  name: recovered\n"})
+	recovered := httptest.NewServer(center)
+	defer recovered.Close()
+	down.options.URL = recovered.URL
+	changed, err := down.poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("expect changed after recovery")
+	}
+	if _, ok := down.FromSnapshot(); ok {
+		t.Fatal("expect switched from snapshot")
+	}
+	if name := settings(t, down)["name"]; name != "recovered" {
+		t.Fatalf("expect app.name recovered, but got %v", name)
+	}
+}
+
+func TestLoadWithoutSnapshot(t *testing.T) {
+	server := httptest.NewServer(newStubCenter())
+	server.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	c := newTestClient(server.URL, dir)
+	if err := c.Load(context.Background()); err == nil {
+		t.Fatal("expect error when config center and snapshot are both unavailable")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	center := newStubCenter()
+	center.notifications = []func(w http.ResponseWriter){
+		func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusNotModified)
+		},
+		func(w http.ResponseWriter) {
+			center.contents["application.yml"] = namespaceContent{Version: "2", Content: "app:\n  name: changed\n"}
+			json.NewEncoder(w).Encode([]notification{{Namespace: "application.yml", Version: "2"}})
+		},
+	}
+	server := httptest.NewServer(center)
+	defer server.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	c := newTestClient(server.URL, dir)
+	if err := c.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changes := make(chan struct{}, 1)
+	go c.Watch(ctx, func() {
+		changes <- struct{}{}
+	})
+	select {
+	case <-changes:
+	case <-ctx.Done():
+		t.Fatal("expect onChange called")
+	}
+	cancel()
+	if name := settings(t, c)["name"]; name != "changed" {
+		t.Fatalf("expect app.name changed, but got %v", name)
+	}
+	center.mu.Lock()
+	defer center.mu.Unlock()
+	if center.polls < 2 {
+		t.Fatalf("expect 304 before notification, but polled %d times", center.polls)
+	}
+}
@@ -31,9 +31,14 @@ type Config interface {
 	GetStringMapStringSlice(key string) map[string][]string
 	GetSizeInBytes(key string) uint
 	IsSet(key string) bool
+	AllSettings() map[string]interface{}
 	Sub(key string) Config
 	Unmarshal(obj interface{}) error
 	UnmarshalKey(key string, obj interface{}) error
+	//key及其子配置项变更时回调, 返回取消函数
+	Watch(key string, fn WatchFunc) func()
+	//订阅所有配置项的变更事件, 返回取消函数
+	Subscribe() (<-chan ChangeEvent, func())
 }
 
 //type ConfigPath string
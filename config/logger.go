@@ -0,0 +1,60 @@
+package config
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sync"
+)
+
+//SetLogger之前最多缓存的日志条数, 超出的丢弃
+const maxPendingLogs = 256
+
+/*
+	配置的加载和监听日志, 配置加载早于logger创建, 之前的日志先缓存,
+	zaplog.New创建logger后调用SetLogger输出缓存的日志, 之后直接输出到配置的sinks
+*/
+var std = &configLogger{}
+
+type pendingLog struct {
+	level  zapcore.Level
+	msg    string
+	fields []zap.Field
+}
+
+type configLogger struct {
+	mu      sync.Mutex
+	logger  *zap.Logger
+	pending []pendingLog
+}
+
+//设置为nil时重新开始缓存
+func SetLogger(logger *zap.Logger) {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	if logger != nil {
+		logger = logger.Named("config").WithOptions(zap.AddCallerSkip(1))
+		for _, p := range std.pending {
+			if ce := logger.Check(p.level, p.msg); ce != nil {
+				ce.Write(p.fields...)
+			}
+		}
+		std.pending = nil
+	}
+	std.logger = logger
+}
+
+func Log(level zapcore.Level, msg string, fields ...zap.Field) {
+	std.mu.Lock()
+	logger := std.logger
+	if logger == nil {
+		if len(std.pending) < maxPendingLogs {
+			std.pending = append(std.pending, pendingLog{level: level, msg: msg, fields: fields})
+		}
+		std.mu.Unlock()
+		return
+	}
+	std.mu.Unlock()
+	if ce := logger.Check(level, msg); ce != nil {
+		ce.Write(fields...)
+	}
+}
@@ -0,0 +1,30 @@
+package config_test
+
+import (
+	"github.com/liuliliujian/go-infra-com/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+func TestLogBeforeSetLogger(t *testing.T) {
+	defer config.SetLogger(nil)
+	config.Log(zapcore.WarnLevel, "started from snapshot", zap.String("snapshot", "s1"))
+	config.Log(zapcore.DebugLevel, "filtered by level")
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	config.SetLogger(zap.New(core))
+	if logs.Len() != 1 {
+		t.Fatalf("expect pending log flushed, but got %v", logs.AllUntimed())
+	}
+	entry := logs.All()[0]
+	if entry.LoggerName != "config" || entry.Level != zapcore.WarnLevel || entry.ContextMap()["snapshot"] != "s1" {
+		t.Fatalf("unexpected log: %+v", entry)
+	}
+
+	config.Log(zapcore.InfoLevel, "config changed")
+	if logs.Len() != 2 || logs.All()[1].Message != "config changed" {
+		t.Fatalf("expect log written to the logger, but got %v", logs.AllUntimed())
+	}
+}
@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/config"
+	"strings"
+)
+
+//直接读取配置项, 不依赖各模块的Options, 按各模块的默认值判断未配置的项
+func init() {
+	prod := []string{config.ENV_PROD}
+	Register(Rule{Name: "gin-debug", Envs: prod, Check: ginDebug})
+	Register(Rule{Name: "db-debug", Envs: prod, Check: dbDebug})
+	Register(Rule{Name: "stdout-debug-log", Envs: prod, Check: stdoutDebugLog})
+	Register(Rule{Name: "admin-no-auth", Envs: prod, Check: adminNoAuth})
+}
+
+//gin未配置mode(包括没有gin配置段)时为debug, 不使用gin的服务可以ignore该规则
+func ginDebug(c config.Config) []string {
+	if mode := strings.ToLower(c.GetString("gin.mode")); mode == "" || mode == "debug" {
+		return []string{"gin.mode must not be debug"}
+	}
+	return nil
+}
+
+func dbDebug(c config.Config) []string {
+	if c.GetBool("db.debug") {
+		return []string{"db.debug must be false, sql with parameters is logged"}
+	}
+	return nil
+}
+
+func stdoutDebugLog(c config.Config) []string {
+	var sinks []struct {
+		FilePath string
+		Level    string
+	}
+	if err := c.UnmarshalKey("zap-logs", &sinks); err != nil {
+		return nil
+	}
+	var messages []string
+	for i, sink := range sinks {
+		if (sink.FilePath == "stdout" || sink.FilePath == "stderr") && strings.EqualFold(sink.Level, "debug") {
+			messages = append(messages, fmt.Sprintf("zap-logs[%d] %s sink must not be at debug level", i, sink.FilePath))
+		}
+	}
+	return messages
+}
+
+func adminNoAuth(c config.Config) []string {
+	if c.GetBool("application.admin.enabled") && c.GetString("application.admin.token") == "" {
+		return []string{"application.admin.token is required when admin server is enabled"}
+	}
+	return nil
+}
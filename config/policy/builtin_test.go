@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/config/vipercfg"
+	"testing"
+)
+
+func ginDebugViolations(t *testing.T, settings map[string]interface{}) []Violation {
+	settings[config.CONF_ENV] = config.ENV_PROD
+	c, err := vipercfg.NewFromSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	violations, err := Check(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ginViolations []Violation
+	for _, violation := range violations {
+		if violation.Rule == "gin-debug" {
+			ginViolations = append(ginViolations, violation)
+		}
+	}
+	return ginViolations
+}
+
+func TestGinDebug(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings map[string]interface{}
+		violated bool
+	}{
+		{"missing gin section", map[string]interface{}{}, true},
+		{"missing mode", map[string]interface{}{"gin": map[string]interface{}{"port": 8080}}, true},
+		{"debug mode", map[string]interface{}{"gin": map[string]interface{}{"mode": "Debug"}}, true},
+		{"release mode", map[string]interface{}{"gin": map[string]interface{}{"mode": "release"}}, false},
+		{"ignored", map[string]interface{}{"application": map[string]interface{}{
+			"policy": map[string]interface{}{"rules": map[string]interface{}{"gin-debug": "ignore"}},
+		}}, false},
+	}
+	for _, c := range cases {
+		violations := ginDebugViolations(t, c.settings)
+		if violated := len(violations) > 0; violated != c.violated {
+			t.Errorf("%s: expect violated %v, but got %v", c.name, c.violated, violations)
+		}
+	}
+}
+
+func TestGinDebugOnlyInProd(t *testing.T) {
+	c, err := vipercfg.NewFromSettings(map[string]interface{}{config.CONF_ENV: config.ENV_DEV})
+	if err != nil {
+		t.Fatal(err)
+	}
+	violations, err := Check(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 0 {
+		t.Fatalf("expect no violation in dev, but got %v", violations)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+按运行环境的启动检查, 例如prod环境禁止gin debug模式, 在启动与config validate时执行
+
+	application:
+	  policy:
+	    mode: fail            #fail: 存在违规时启动失败, warn: 只输出警告
+	    rules:
+	      db-debug: warn      #单独指定规则的级别, ignore关闭规则
+*/
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/config"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	CONF_POLICY = config.CONF_APP_PREF + ".policy"
+
+	LEVEL_FAIL   = "fail"
+	LEVEL_WARN   = "warn"
+	LEVEL_IGNORE = "ignore"
+)
+
+type Options struct {
+	Mode  string            `default:"fail" oneof:"fail warn"`
+	Rules map[string]string //规则名 -> fail/warn/ignore
+}
+
+func init() {
+	config.RegisterSchema(CONF_POLICY, Options{})
+}
+
+func NewOptions(c config.Config) (*Options, error) {
+	o := &Options{}
+	if err := config.Bind(c, CONF_POLICY, o); err != nil {
+		return nil, err
+	}
+	o.Mode = strings.ToLower(o.Mode)
+	for name, level := range o.Rules {
+		switch strings.ToLower(level) {
+		case LEVEL_FAIL, LEVEL_WARN, LEVEL_IGNORE:
+		default:
+			return nil, &config.BindError{Key: CONF_POLICY, Fields: []config.FieldError{
+				{Key: CONF_POLICY + ".rules." + name, Message: fmt.Sprintf("must be one of [fail warn ignore], but got [%s]", level)},
+			}}
+		}
+	}
+	return o, nil
+}
+
+//检查规则, Check返回违规的描述, 没有违规时返回空
+type Rule struct {
+	Name  string
+	Envs  []string //生效的环境, 为空时所有环境生效
+	Check func(c config.Config) []string
+}
+
+type Violation struct {
+	Rule    string
+	Level   string
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("[%s] %s", v.Rule, v.Message)
+}
+
+var (
+	mu    sync.RWMutex
+	rules []Rule
+)
+
+//注册规则, 同名规则被替换
+func Register(rule Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range rules {
+		if rules[i].Name == rule.Name {
+			rules[i] = rule
+			return
+		}
+	}
+	rules = append(rules, rule)
+}
+
+func Rules() []Rule {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Rule(nil), rules...)
+}
+
+//执行当前环境生效的规则
+func Check(c config.Config) ([]Violation, error) {
+	o, err := NewOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	env := config.GetEnvironment(c)
+	var violations []Violation
+	for _, rule := range Rules() {
+		if len(rule.Envs) > 0 && !contains(rule.Envs, env) {
+			continue
+		}
+		level := o.Mode
+		if override, ok := o.Rules[strings.ToLower(rule.Name)]; ok {
+			level = strings.ToLower(override)
+		}
+		if level == LEVEL_IGNORE {
+			continue
+		}
+		for _, message := range rule.Check(c) {
+			violations = append(violations, Violation{Rule: rule.Name, Level: level, Message: message})
+		}
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Level == LEVEL_FAIL && violations[j].Level != LEVEL_FAIL
+	})
+	return violations, nil
+}
+
+//输出warn级别的违规, 存在fail级别的违规时返回错误
+func Enforce(c config.Config, logger *zap.Logger) error {
+	violations, err := Check(c)
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for _, violation := range violations {
+		if violation.Level == LEVEL_FAIL {
+			failed = append(failed, violation.String())
+			continue
+		}
+		logger.Warn("config policy violated", zap.String("rule", violation.Rule), zap.String("message", violation.Message))
+	}
+	if len(failed) > 0 {
+		return errors.New(fmt.Sprintf("config policy violated in env[%s]: %s", config.GetEnvironment(c), strings.Join(failed, "; ")))
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const REDACTED = "******"
+
+var (
+	sensitiveKeyPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(password|passwd|pwd|passphrase|secret|token|credential|private[-_]?key|access[-_]?key|api[-_]?key)`),
+	}
+	//mysql dsn中的密码, 例如 root:pass@tcp(...)/db 或 root:pass@/db, 密码可能包含@, 匹配最后一个地址前的@
+	dsnCredentialPattern = regexp.MustCompile(`^([^:/@\s]+):\S*@([a-zA-Z0-9]*\(|/)`)
+	//net/url无法解析的url, 只匹配host之前的userinfo
+	urlCredentialPattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*://[^:/?#@\s]*):[^/?#@\s]*@`)
+	//dsn参数中的密码, 例如 host=x password=pass 或 ?user=a&password=pass 或 User ID=sa;Password=pass
+	dsnParamPattern = regexp.MustCompile(`(?i)((?:^|[?&;\s])(?:password|passwd|pwd)\s*=\s*)[^&;\s]*`)
+)
+
+//添加敏感key的匹配规则, 需在使用前(例如init中)调用
+func AddSensitiveKeyPattern(patterns ...*regexp.Regexp) {
+	sensitiveKeyPatterns = append(sensitiveKeyPatterns, patterns...)
+}
+
+//未解析secret引用的原始配置, 实现该接口的Config在展示时保留引用与密文原文
+type RawSettingsProvider interface {
+	RawSettings() map[string]interface{}
+}
+
+//用于展示的生效配置, secret引用不解析并脱敏
+func DisplaySettings(c Config) map[string]interface{} {
+	if raw, ok := c.(RawSettingsProvider); ok {
+		return Redact(raw.RawSettings())
+	}
+	return Redact(c.AllSettings())
+}
+
+func IsSensitiveKey(key string) bool {
+	for _, pattern := range sensitiveKeyPatterns {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+//隐藏dsn中的密码, 保留用户名便于排查
+//url形式(scheme://)只隐藏userinfo中的密码, path与query中的@不受影响
+func RedactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		dsn = redactURL(dsn)
+	} else {
+		dsn = dsnCredentialPattern.ReplaceAllString(dsn, "${1}:"+REDACTED+"@${2}")
+	}
+	return dsnParamPattern.ReplaceAllString(dsn, "${1}"+REDACTED)
+}
+
+func redactURL(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Opaque != "" {
+		return urlCredentialPattern.ReplaceAllString(dsn, "${1}:"+REDACTED+"@")
+	}
+	if u.User == nil {
+		return dsn
+	}
+	if _, ok := u.User.Password(); !ok {
+		return dsn
+	}
+	//只替换原文中的密码, url.String会转义*并重新编码其余部分
+	start := strings.Index(dsn, "://") + len("://")
+	end := len(dsn)
+	if i := strings.IndexAny(dsn[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	at := strings.LastIndex(dsn[start:end], "@") + start
+	colon := strings.Index(dsn[start:at], ":") + start
+	return dsn[:colon+1] + REDACTED + dsn[at:]
+}
+
+//返回脱敏后的配置副本, 敏感key的值整体隐藏, 其余字符串隐藏dsn密码
+func Redact(settings map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(settings))
+	for k, v := range settings {
+		redacted[k] = redactValue(k, v)
+	}
+	return redacted
+}
+
+func redactValue(key string, value interface{}) interface{} {
+	if IsSensitiveKey(key) {
+		return REDACTED
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return Redact(v)
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = e
+		}
+		return Redact(m)
+	case []interface{}:
+		s := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			s = append(s, redactValue(key, e))
+		}
+		return s
+	}
+	if s, ok := value.(string); ok {
+		return RedactDSN(s)
+	}
+	return value
+}
@@ -0,0 +1,474 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/spf13/cast"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const CONF_STRICT = "config.strict" //true时存在未知配置项启动失败, 否则只输出警告
+
+//配置段的schema, 由各模块在init中注册自身的Options
+//同一个key可以注册多次, 字段合并, 例如application由config与bootstrap分别注册
+type Schema struct {
+	Key   string
+	Types []reflect.Type
+}
+
+//schema中的单个配置项
+type SchemaField struct {
+	Key      string //相对于所在配置段的路径, slice元素为key[], map的值为key.{name}
+	Type     string //string, boolean, integer, number, duration, array, object
+	Default  string
+	Required bool
+	Min      string
+	Max      string
+	OneOf    []string
+}
+
+var (
+	schemaMu sync.RWMutex
+	schemas  = make(map[string]*Schema)
+)
+
+func init() {
+	RegisterSchema(CONF_APP_PREF, struct {
+		Name      string
+		StackDump bool
+	}{})
+	RegisterSchema("config", struct {
+		Strict bool
+	}{})
+}
+
+//obj为Options的零值或指针, 配置为list时传入slice, 例如zap-logs
+func RegisterSchema(key string, obj interface{}) {
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	key = strings.ToLower(key)
+	schema, ok := schemas[key]
+	if !ok {
+		schema = &Schema{Key: key}
+		schemas[key] = schema
+	}
+	for _, registered := range schema.Types {
+		if registered == t {
+			return
+		}
+	}
+	schema.Types = append(schema.Types, t)
+}
+
+//按key排序的所有已注册schema
+func Schemas() []Schema {
+	schemaMu.RLock()
+	defer schemaMu.RUnlock()
+	list := make([]Schema, 0, len(schemas))
+	for _, schema := range schemas {
+		list = append(list, *schema)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+func isSchemaKey(key string) bool {
+	schemaMu.RLock()
+	defer schemaMu.RUnlock()
+	_, ok := schemas[key]
+	return ok
+}
+
+//配置段下的所有配置项, 嵌套的struct展开为叶子节点
+func (s Schema) Fields() []SchemaField {
+	var fields []SchemaField
+	for _, t := range s.Types {
+		fields = appendFields(fields, t, "")
+	}
+	return fields
+}
+
+func appendFields(fields []SchemaField, t reflect.Type, prefix string) []SchemaField {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			field, ok := schemaFieldOf(f)
+			if !ok {
+				continue
+			}
+			key := field.key
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = appendFields(fields, ft, key)
+				continue
+			}
+			if (ft.Kind() == reflect.Slice || ft.Kind() == reflect.Map) && elemStruct(ft) {
+				fields = appendFields(fields, ft, key)
+				continue
+			}
+			fields = append(fields, newSchemaField(key, ft, field.tag))
+		}
+	case reflect.Slice, reflect.Array:
+		fields = appendFields(fields, t.Elem(), prefix+"[]")
+	case reflect.Map:
+		if prefix != "" {
+			prefix += "."
+		}
+		fields = appendFields(fields, t.Elem(), prefix+"{name}")
+	}
+	return fields
+}
+
+func newSchemaField(key string, t reflect.Type, tag reflect.StructTag) SchemaField {
+	return SchemaField{
+		Key:      key,
+		Type:     schemaType(t),
+		Default:  tag.Get(TAG_DEFAULT),
+		Required: tag.Get(TAG_REQUIRED) == "true",
+		Min:      tag.Get(TAG_MIN),
+		Max:      tag.Get(TAG_MAX),
+		OneOf:    strings.Fields(tag.Get(TAG_ONEOF)),
+	}
+}
+
+//chan与func等无法配置的字段不属于schema
+func schemaFieldOf(f reflect.StructField) (bindField, bool) {
+	switch f.Type.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return bindField{}, false
+	}
+	return fieldOf(f)
+}
+
+func elemStruct(t reflect.Type) bool {
+	elem := t.Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct
+}
+
+func schemaType(t reflect.Type) string {
+	if t == durationType {
+		return "duration"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+//已注册配置段下未知的配置项, 例如db.maxIdelConns, 未注册的配置段不检查
+func UnknownKeys(c Config) []string {
+	settings := c.AllSettings()
+	if raw, ok := c.(RawSettingsProvider); ok {
+		settings = raw.RawSettings()
+	}
+	var unknown []string
+	for _, schema := range Schemas() {
+		value := Lookup(settings, schema.Key)
+		if value == nil {
+			continue
+		}
+		unknown = append(unknown, unknownKeys(value, schema.Types, schema.Key)...)
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+//CONF_STRICT为true时返回错误, 否则返回未知配置项由调用方输出警告
+func CheckUnknownKeys(c Config) ([]string, error) {
+	unknown := UnknownKeys(c)
+	if len(unknown) > 0 && c.GetBool(CONF_STRICT) {
+		return unknown, errors.New(fmt.Sprintf("unknown config keys: %s", strings.Join(unknown, ", ")))
+	}
+	return unknown, nil
+}
+
+func unknownKeys(value interface{}, types []reflect.Type, path string) []string {
+	var unknown []string
+	//viper不转换yaml列表中的元素, 例如zap-logs[i]为map[interface{}]interface{}
+	if m, ok := value.(map[interface{}]interface{}); ok {
+		value = cast.ToStringMap(m)
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		var elems []reflect.Type
+		for _, t := range types {
+			t = indirect(t)
+			if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+				elems = append(elems, t.Elem())
+			}
+		}
+		if len(elems) == 0 {
+			return nil
+		}
+		for i, elem := range v {
+			unknown = append(unknown, unknownKeys(elem, elems, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case map[string]interface{}:
+		fields := make(map[string][]reflect.Type)
+		structs := false
+		for _, t := range types {
+			t = indirect(t)
+			//以名称为key的配置, 例如featureflags.{name}
+			if t.Kind() == reflect.Map && elemStruct(t) {
+				for key, child := range v {
+					unknown = append(unknown, unknownKeys(child, []reflect.Type{t.Elem()}, path+"."+key)...)
+				}
+				continue
+			}
+			if t.Kind() != reflect.Struct {
+				continue
+			}
+			structs = true
+			for i := 0; i < t.NumField(); i++ {
+				if field, ok := schemaFieldOf(t.Field(i)); ok {
+					key := strings.ToLower(field.key)
+					fields[key] = append(fields[key], t.Field(i).Type)
+				}
+			}
+		}
+		//map等自由格式的配置不检查
+		if !structs {
+			return unknown
+		}
+		for key, child := range v {
+			childPath := path + "." + key
+			fieldTypes, ok := fields[strings.ToLower(key)]
+			if !ok {
+				if !isSchemaKey(strings.ToLower(childPath)) {
+					unknown = append(unknown, childPath)
+				}
+				continue
+			}
+			unknown = append(unknown, unknownKeys(child, fieldTypes, childPath)...)
+		}
+	}
+	return unknown
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+//生成JSON Schema(draft-07), 已注册的配置段不允许未知属性
+func JSONSchema() map[string]interface{} {
+	root := map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      "infra-com configuration",
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+	for _, schema := range Schemas() {
+		parent := root
+		parts := strings.Split(schema.Key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			parent = childSchema(parent, part)
+		}
+		node := childSchema(parent, parts[len(parts)-1])
+		for _, t := range schema.Types {
+			mergeSchema(node, typeSchema(t, ""))
+		}
+	}
+	return root
+}
+
+func childSchema(parent map[string]interface{}, key string) map[string]interface{} {
+	properties, ok := parent["properties"].(map[string]interface{})
+	if !ok {
+		properties = make(map[string]interface{})
+		parent["properties"] = properties
+		parent["type"] = "object"
+	}
+	child, ok := properties[key].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{"type": "object"}
+		properties[key] = child
+	}
+	return child
+}
+
+//同一配置段的多个类型及单独注册的子配置段合并properties与required
+func mergeSchema(node map[string]interface{}, s map[string]interface{}) {
+	for k, v := range s {
+		switch k {
+		case "properties":
+			properties, ok := node["properties"].(map[string]interface{})
+			if !ok {
+				properties = make(map[string]interface{})
+				node["properties"] = properties
+			}
+			for name, property := range v.(map[string]interface{}) {
+				properties[name] = property
+			}
+		case "required":
+			required, _ := node["required"].([]string)
+			node["required"] = append(required, v.([]string)...)
+		default:
+			node[k] = v
+		}
+	}
+}
+
+func typeSchema(t reflect.Type, tag reflect.StructTag) map[string]interface{} {
+	t = indirect(t)
+	s := make(map[string]interface{})
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			field, ok := schemaFieldOf(f)
+			if !ok {
+				continue
+			}
+			properties[field.key] = typeSchema(f.Type, field.tag)
+			if field.tag.Get(TAG_REQUIRED) == "true" {
+				required = append(required, field.key)
+			}
+		}
+		s["type"] = "object"
+		s["properties"] = properties
+		s["additionalProperties"] = false
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	case reflect.Slice, reflect.Array:
+		s["type"] = "array"
+		s["items"] = typeSchema(t.Elem(), "")
+	case reflect.Map:
+		s["type"] = "object"
+		s["additionalProperties"] = typeSchema(t.Elem(), "")
+	}
+
+	kind := schemaType(t)
+	switch kind {
+	case "duration":
+		s["type"] = "string"
+		s["pattern"] = `^(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+$`
+		s["description"] = "duration, e.g. 10s, 1m30s"
+	case "string", "boolean", "integer", "number":
+		s["type"] = kind
+	}
+	if def, ok := tag.Lookup(TAG_DEFAULT); ok {
+		s["default"] = schemaValue(kind, def)
+	}
+	if oneof := strings.Fields(tag.Get(TAG_ONEOF)); len(oneof) > 0 {
+		s["enum"] = oneof
+	}
+	limits := map[string][2]string{
+		"integer": {"minimum", "maximum"},
+		"number":  {"minimum", "maximum"},
+		"string":  {"minLength", "maxLength"},
+		"array":   {"minItems", "maxItems"},
+	}
+	if names, ok := limits[kind]; ok {
+		for i, tagName := range []string{TAG_MIN, TAG_MAX} {
+			if bound, ok := tag.Lookup(tagName); ok {
+				s[names[i]] = schemaValue("number", bound)
+			}
+		}
+	}
+	return s
+}
+
+func schemaValue(kind string, s string) interface{} {
+	switch kind {
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case "integer":
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "array":
+		parts := strings.Split(s, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		return parts
+	}
+	return s
+}
+
+//生成markdown格式的配置参考文档
+func SchemaMarkdown() string {
+	var buf bytes.Buffer
+	buf.WriteString("# Configuration reference\n")
+	for _, schema := range Schemas() {
+		fmt.Fprintf(&buf, "\n## %s\n\n", schema.Key)
+		buf.WriteString("| Key | Type | Default | Constraints |\n")
+		buf.WriteString("| --- | --- | --- | --- |\n")
+		for _, field := range schema.Fields() {
+			var constraints []string
+			if field.Required {
+				constraints = append(constraints, "required")
+			}
+			if field.Min != "" {
+				constraints = append(constraints, "min "+field.Min)
+			}
+			if field.Max != "" {
+				constraints = append(constraints, "max "+field.Max)
+			}
+			if len(field.OneOf) > 0 {
+				constraints = append(constraints, "one of "+strings.Join(field.OneOf, "/"))
+			}
+			key := schema.Key + "." + field.Key
+			if strings.HasPrefix(field.Key, "[]") {
+				key = schema.Key + field.Key
+			}
+			fmt.Fprintf(&buf, "| %s | %s | %s | %s |\n", key, field.Type,
+				markdownCell(field.Default), strings.Join(constraints, ", "))
+		}
+	}
+	return buf.String()
+}
+
+func markdownCell(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.Replace(s, "|", "\\|", -1) + "`"
+}
@@ -0,0 +1,45 @@
+package config_test
+
+import (
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/config/vipercfg"
+	_ "github.com/liuliliujian/go-infra-com/log/zaplog"
+	"reflect"
+	"testing"
+)
+
+func TestUnknownKeysInList(t *testing.T) {
+	c, err := vipercfg.NewFromSettings(map[string]interface{}{
+		"application": map[string]interface{}{"name": "demo"},
+		"zap-logs": []interface{}{
+			map[string]interface{}{"filePath": "stdout", "level": "info"},
+			map[string]interface{}{"filePath": "app.log", "levle": "debug", "sampling": map[string]interface{}{"tik": "1s"}},
+		},
+		"zap-mask": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"fields": []interface{}{"password"}, "keeplast": 4, "keepLastt": 4},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := config.UnknownKeys(c)
+	expected := []string{"zap-logs[1].levle", "zap-logs[1].sampling.tik", "zap-mask.rules[0].keepLastt"}
+	if !reflect.DeepEqual(unknown, expected) {
+		t.Fatalf("expect unknown keys %v, but got %v", expected, unknown)
+	}
+}
+
+func TestCheckUnknownKeysStrict(t *testing.T) {
+	c, err := vipercfg.NewFromSettings(map[string]interface{}{
+		"config":   map[string]interface{}{"strict": true},
+		"zap-logs": []interface{}{map[string]interface{}{"filePath": "stdout", "levle": "info"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.CheckUnknownKeys(c); err == nil {
+		t.Fatal("expect error for unknown key in strict mode")
+	}
+}
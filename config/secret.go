@@ -0,0 +1,220 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	errs "github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	ENV_SECRET_KEY      = "INFRA_CONFIG_KEY"      //base64编码的AES key, 16/24/32字节
+	ENV_SECRET_KEY_FILE = "INFRA_CONFIG_KEY_FILE" //内容为base64编码AES key的文件, 未配置ENV_SECRET_KEY时使用
+
+	ENC_PREFIX = "ENC("
+	ENC_SUFFIX = ")"
+)
+
+//${env:NAME}, ${file:/run/secrets/x}, 可嵌入字符串中, 例如 root:${env:DB_PASSWORD}@tcp(...)
+var secretRefPattern = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+//是否包含secret引用或密文
+func IsSecretRef(value string) bool {
+	return isEncrypted(value) || secretRefPattern.MatchString(value)
+}
+
+func isEncrypted(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, ENC_PREFIX) && strings.HasSuffix(value, ENC_SUFFIX)
+}
+
+//解析配置值中的secret引用与密文, 结果按原始值缓存, 配置重新加载时调用Reset以读取轮换后的secret
+type Resolver struct {
+	mu    sync.Mutex
+	key   []byte
+	cache map[string]string
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{cache: make(map[string]string)}
+}
+
+func (r *Resolver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.key = nil
+	r.cache = make(map[string]string)
+}
+
+func (r *Resolver) Resolve(value string) (string, error) {
+	if !IsSecretRef(value) {
+		return value, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if resolved, ok := r.cache[value]; ok {
+		return resolved, nil
+	}
+	resolved, err := r.resolve(value)
+	if err != nil {
+		return "", err
+	}
+	r.cache[value] = resolved
+	return resolved, nil
+}
+
+func (r *Resolver) resolve(value string) (string, error) {
+	if isEncrypted(value) {
+		if r.key == nil {
+			key, err := LoadSecretKey()
+			if err != nil {
+				return "", err
+			}
+			r.key = key
+		}
+		trimmed := strings.TrimSpace(value)
+		return Decrypt(r.key, trimmed[len(ENC_PREFIX):len(trimmed)-len(ENC_SUFFIX)])
+	}
+	var resolveErr error
+	resolved := secretRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		match := secretRefPattern.FindStringSubmatch(ref)
+		kind, name := match[1], strings.TrimSpace(match[2])
+		if kind == "env" {
+			v, ok := os.LookupEnv(name)
+			if !ok && resolveErr == nil {
+				resolveErr = errors.New(fmt.Sprintf("env[%s] referenced by config is not set", name))
+			}
+			return v
+		}
+		content, err := ioutil.ReadFile(name)
+		if err != nil && resolveErr == nil {
+			resolveErr = errs.WithMessage(err, fmt.Sprintf("failed to read secret file[%s] referenced by config", name))
+		}
+		return strings.TrimRight(string(content), "\r\n")
+	})
+	return resolved, resolveErr
+}
+
+//递归解析map/list中的字符串, 返回新的副本
+func (r *Resolver) ResolveAll(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return r.Resolve(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			resolved, err := r.ResolveAll(e)
+			if err != nil {
+				return nil, errs.WithMessage(err, k)
+			}
+			m[k] = resolved
+		}
+		return m, nil
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, e := range v {
+			resolved, err := r.ResolveAll(e)
+			if err != nil {
+				return nil, errs.WithMessage(err, fmt.Sprint(k))
+			}
+			m[k] = resolved
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, 0, len(v))
+		for i, e := range v {
+			resolved, err := r.ResolveAll(e)
+			if err != nil {
+				return nil, errs.WithMessage(err, fmt.Sprintf("[%d]", i))
+			}
+			s = append(s, resolved)
+		}
+		return s, nil
+	case []string:
+		s := make([]string, 0, len(v))
+		for i, e := range v {
+			resolved, err := r.Resolve(e)
+			if err != nil {
+				return nil, errs.WithMessage(err, fmt.Sprintf("[%d]", i))
+			}
+			s = append(s, resolved)
+		}
+		return s, nil
+	}
+	return value, nil
+}
+
+//从ENV_SECRET_KEY或ENV_SECRET_KEY_FILE读取AES key
+func LoadSecretKey() ([]byte, error) {
+	encoded := os.Getenv(ENV_SECRET_KEY)
+	if encoded == "" {
+		file := os.Getenv(ENV_SECRET_KEY_FILE)
+		if file == "" {
+			return nil, errors.New(fmt.Sprintf("config secret key is required to decrypt ENC() values, set env %s or %s", ENV_SECRET_KEY, ENV_SECRET_KEY_FILE))
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errs.WithMessage(err, "failed to read config secret key file")
+		}
+		encoded = string(content)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errs.WithMessage(err, "config secret key must be base64 encoded")
+	}
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return nil, errors.New(fmt.Sprintf("config secret key must be 16/24/32 bytes, but got %d", len(key)))
+	}
+	return key, nil
+}
+
+//AES-GCM加密, 返回ENC(base64(nonce+ciphertext))
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return ENC_PREFIX + base64.StdEncoding.EncodeToString(sealed) + ENC_SUFFIX, nil
+}
+
+//解密ENC()中的base64内容
+func Decrypt(key []byte, encoded string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", errs.WithMessage(err, "invalid encrypted config value")
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted config value")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errs.WithMessage(err, "failed to decrypt config value, check the secret key")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errs.WithMessage(err, "invalid config secret key")
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	errs "github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//远程配置的本地快照, 内容带sha256校验, 用于远程配置不可用时启动
+type Snapshot struct {
+	path string
+}
+
+type snapshotFile struct {
+	Checksum string          `json:"checksum"`
+	SavedAt  time.Time       `json:"savedAt"`
+	Data     json.RawMessage `json:"data"`
+}
+
+func NewSnapshot(path string) *Snapshot {
+	return &Snapshot{path: path}
+}
+
+func (s *Snapshot) Path() string {
+	return s.path
+}
+
+//data序列化为json后写入临时文件再rename, 避免进程退出时留下不完整的快照
+func (s *Snapshot) Save(data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return errs.WithMessage(err, "invalid config snapshot")
+	}
+	content, err := json.Marshal(snapshotFile{Checksum: checksum(raw), SavedAt: time.Now(), Data: raw})
+	if err != nil {
+		return errs.WithMessage(err, "invalid config snapshot")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return errs.WithMessage(err, fmt.Sprintf("failed to create config snapshot dir of %s", s.path))
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return errs.WithMessage(err, fmt.Sprintf("failed to write config snapshot %s", s.path))
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return errs.WithMessage(err, fmt.Sprintf("failed to write config snapshot %s", s.path))
+	}
+	if err := tmp.Close(); err != nil {
+		return errs.WithMessage(err, fmt.Sprintf("failed to write config snapshot %s", s.path))
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return errs.WithMessage(err, fmt.Sprintf("failed to write config snapshot %s", s.path))
+	}
+	return nil
+}
+
+//读取快照并校验checksum, 返回快照的保存时间
+func (s *Snapshot) Load(data interface{}) (time.Time, error) {
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return time.Time{}, errs.WithMessage(err, fmt.Sprintf("failed to read config snapshot %s", s.path))
+	}
+	var file snapshotFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return time.Time{}, errs.WithMessage(err, fmt.Sprintf("corrupted config snapshot %s", s.path))
+	}
+	if file.Checksum != checksum(file.Data) {
+		return time.Time{}, errors.New(fmt.Sprintf("corrupted config snapshot %s, checksum mismatch", s.path))
+	}
+	if err := json.Unmarshal(file.Data, data); err != nil {
+		return time.Time{}, errs.WithMessage(err, fmt.Sprintf("corrupted config snapshot %s", s.path))
+	}
+	return file.SavedAt, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
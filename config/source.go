@@ -0,0 +1,50 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+//配置项的来源, 文件与远程配置为"file:路径", "etcd:路径", "center:应用/namespace"形式
+const (
+	SOURCE_FLAG     = "flag"
+	SOURCE_ENV      = "env"
+	SOURCE_DEFAULT  = "default"  //flag的默认值
+	SOURCE_SETTINGS = "settings" //代码中直接提供的配置, 例如测试
+)
+
+//记录每个生效配置项(叶子节点)的来源
+type SourceProvider interface {
+	Sources() map[string]string
+}
+
+//返回key的来源, 不支持时返回空字符串
+func SourceOf(c Config, key string) string {
+	if provider, ok := c.(SourceProvider); ok {
+		return provider.Sources()[strings.ToLower(key)]
+	}
+	return ""
+}
+
+//带来源的脱敏配置项, 按key排序
+type SourcedValue struct {
+	Key    string      `json:"key" yaml:"key"`
+	Value  interface{} `json:"value" yaml:"value"`
+	Source string      `json:"source" yaml:"source"`
+}
+
+func DisplaySources(c Config) []SourcedValue {
+	var sources map[string]string
+	if provider, ok := c.(SourceProvider); ok {
+		sources = provider.Sources()
+	}
+	leaves := Flatten(DisplaySettings(c))
+	values := make([]SourcedValue, 0, len(leaves))
+	for key, value := range leaves {
+		values = append(values, SourcedValue{Key: key, Value: value, Source: sources[key]})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Key < values[j].Key
+	})
+	return values
+}
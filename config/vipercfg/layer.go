@@ -0,0 +1,146 @@
+package vipercfg
+
+import (
+	"errors"
+	"fmt"
+	errs "github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	CONF_INCLUDE = "include" //配置文件中引用其他文件, 路径相对于当前文件
+	LOCAL_SUFFIX = "local"   //本地覆盖配置, 例如conf-local.yml, 不提交到git
+)
+
+var searchPaths = []string{".", "config/", "conf/"}
+
+//一层配置, 按优先级从低到高合并
+type layer struct {
+	source   string //来源, 例如 file:conf/conf.yml, etcd:/config/app.yml
+	settings map[string]interface{}
+}
+
+//配置文件组合: {name}.{ext} < {name}-{env}.{ext} < {name}-local.{ext}
+//map逐层深度合并, list(例如zap-logs)及其他值由高优先级整体替换
+type profile struct {
+	dir  string
+	name string
+	env  string
+	base string //指定的配置文件
+}
+
+//指定配置文件时以其为基础配置, 否则在searchPaths中查找conf.{ext}或conf-{env}.{ext}
+func findProfile(configFile string, env string) (*profile, error) {
+	if configFile != "" {
+		if _, err := os.Stat(configFile); err != nil {
+			return nil, errs.WithMessagef(err, "failed to load config file:%s\n", configFile)
+		}
+		base := filepath.Base(configFile)
+		return &profile{
+			dir:  filepath.Dir(configFile),
+			name: strings.TrimSuffix(base, filepath.Ext(base)),
+			env:  env,
+			base: filepath.Clean(configFile),
+		}, nil
+	}
+	for _, dir := range searchPaths {
+		p := &profile{dir: filepath.Clean(dir), name: "conf", env: env}
+		if len(p.files()) > 0 {
+			return p, nil
+		}
+	}
+	return nil, errs.New("config file not found")
+}
+
+//按优先级排列的各层文件名(不含扩展名)
+func (p *profile) names() []string {
+	names := []string{p.name}
+	if p.env != "" {
+		names = append(names, p.name+"-"+p.env)
+	}
+	return append(names, p.name+"-"+LOCAL_SUFFIX)
+}
+
+//存在的各层文件
+func (p *profile) files() []string {
+	files := make([]string, 0, 3)
+	for i, name := range p.names() {
+		if i == 0 && p.base != "" {
+			files = append(files, p.base)
+			continue
+		}
+		for _, ext := range viper.SupportedExts {
+			file := filepath.Join(p.dir, name+"."+ext)
+			if info, err := os.Stat(file); err == nil && !info.IsDir() {
+				files = append(files, file)
+				break
+			}
+		}
+	}
+	return files
+}
+
+//可能出现的各层文件, 用于监听新建的文件
+func (p *profile) candidates() []string {
+	candidates := make([]string, 0, len(viper.SupportedExts)*3)
+	for _, name := range p.names() {
+		for _, ext := range viper.SupportedExts {
+			candidates = append(candidates, filepath.Join(p.dir, name+"."+ext))
+		}
+	}
+	return candidates
+}
+
+//读取各层文件, include的文件作为单独的层, 返回配置层与读取过的所有文件
+func (p *profile) read() ([]layer, []string, error) {
+	layers := make([]layer, 0, 3)
+	for _, file := range p.files() {
+		fileLayers, err := readFile(file, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, fileLayers...)
+	}
+	files := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		files = append(files, strings.TrimPrefix(layer.source, "file:"))
+	}
+	return layers, files, nil
+}
+
+//读取配置文件, include的文件在前, 当前文件的配置优先
+func readFile(file string, visiting []string) ([]layer, error) {
+	file = filepath.Clean(file)
+	for _, f := range visiting {
+		if f == file {
+			return nil, errors.New(fmt.Sprintf("circular config include: %v", append(visiting, file)))
+		}
+	}
+	visiting = append(visiting, file)
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, errs.WithMessagef(err, "failed to load config file:%s\n", file)
+	}
+	own := v.AllSettings()
+	includes := cast.ToStringSlice(own[CONF_INCLUDE])
+	delete(own, CONF_INCLUDE)
+
+	layers := make([]layer, 0, len(includes)+1)
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(file), include)
+		}
+		included, err := readFile(include, visiting)
+		if err != nil {
+			return nil, errs.WithMessage(err, fmt.Sprintf("included by %s", file))
+		}
+		layers = append(layers, included...)
+	}
+	return append(layers, layer{source: "file:" + file, settings: own}), nil
+}
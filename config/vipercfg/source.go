@@ -0,0 +1,36 @@
+package vipercfg
+
+import (
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+)
+
+var envKeyReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+//按viper的优先级计算每个叶子节点的来源: flag > env > 各层配置文件 > etcd > flag默认值
+func sources(v *viper.Viper, layers []layer) map[string]string {
+	sources := make(map[string]string)
+	for _, layer := range layers {
+		for key := range config.Flatten(layer.settings) {
+			sources[key] = layer.source
+		}
+	}
+	for key := range config.Flatten(v.AllSettings()) {
+		if _, ok := sources[key]; !ok {
+			sources[key] = config.SOURCE_DEFAULT
+		}
+		if os.Getenv(strings.ToUpper(envKeyReplacer.Replace(key))) != "" {
+			sources[key] = config.SOURCE_ENV
+		}
+	}
+	pflag.CommandLine.VisitAll(func(flag *pflag.Flag) {
+		key := strings.ToLower(flag.Name)
+		if flag.Changed {
+			sources[key] = config.SOURCE_FLAG
+		}
+	})
+	return sources
+}
@@ -1,31 +1,206 @@
 package vipercfg
 
 import (
+	"bytes"
+	"context"
 	"github.com/liuliliujian/go-infra-com/config"
-	"fmt"
+	"github.com/liuliliujian/go-infra-com/config/centercfg"
+	"flag"
+	"path/filepath"
 	"github.com/google/wire"
+	"github.com/mitchellh/mapstructure"
 	errs "github.com/pkg/errors"
+	"github.com/spf13/cast"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	_ "github.com/spf13/viper/remote"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v2"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type viperConfig struct {
-	*viper.Viper
+	current  atomic.Value //*state, 重新加载后整体替换, 读取无需加锁
+	watcher  *config.Watcher
+	resolver *config.Resolver
+	root     *viperConfig //Sub返回的快照通过root订阅变更
+	prefix   string
+	loader   *loader
+	mu       sync.Mutex //串行化重新加载
+	cancel   context.CancelFunc
+	done     chan struct{}
+	once     sync.Once
 }
 
+//配置与各配置项的来源
+type state struct {
+	viper   *viper.Viper
+	sources map[string]string
+}
+
+func (v *viperConfig) snapshot() *viper.Viper {
+	return v.current.Load().(*state).viper
+}
+
+func (v *viperConfig) Sources() map[string]string {
+	return v.current.Load().(*state).sources
+}
+
+//返回值中的secret引用与密文已解析, 加载配置时已校验可以解析
+func (v *viperConfig) Get(key string) interface{} { return v.resolve(key, v.snapshot().Get(key)) }
+
+func (v *viperConfig) GetString(key string) string { return cast.ToString(v.Get(key)) }
+
+func (v *viperConfig) GetBool(key string) bool { return cast.ToBool(v.Get(key)) }
+
+func (v *viperConfig) GetInt(key string) int { return cast.ToInt(v.Get(key)) }
+
+func (v *viperConfig) GetInt32(key string) int32 { return cast.ToInt32(v.Get(key)) }
+
+func (v *viperConfig) GetInt64(key string) int64 { return cast.ToInt64(v.Get(key)) }
+
+func (v *viperConfig) GetFloat64(key string) float64 { return cast.ToFloat64(v.Get(key)) }
+
+func (v *viperConfig) GetTime(key string) time.Time { return cast.ToTime(v.Get(key)) }
+
+func (v *viperConfig) GetDuration(key string) time.Duration { return cast.ToDuration(v.Get(key)) }
+
+func (v *viperConfig) GetStringSlice(key string) []string { return cast.ToStringSlice(v.Get(key)) }
+
+func (v *viperConfig) GetStringMap(key string) map[string]interface{} {
+	return cast.ToStringMap(v.Get(key))
+}
+
+func (v *viperConfig) GetStringMapString(key string) map[string]string {
+	return cast.ToStringMapString(v.Get(key))
+}
+
+func (v *viperConfig) GetStringMapStringSlice(key string) map[string][]string {
+	return cast.ToStringMapStringSlice(v.Get(key))
+}
+
+func (v *viperConfig) GetSizeInBytes(key string) uint { return v.snapshot().GetSizeInBytes(key) }
+
+func (v *viperConfig) IsSet(key string) bool { return v.snapshot().IsSet(key) }
+
+func (v *viperConfig) AllSettings() map[string]interface{} {
+	return cast.ToStringMap(v.resolve("", v.snapshot().AllSettings()))
+}
+
+func (v *viperConfig) RawSettings() map[string]interface{} { return v.snapshot().AllSettings() }
+
+func (v *viperConfig) resolve(key string, value interface{}) interface{} {
+	resolved, err := v.rootConfig().resolver.ResolveAll(value)
+	if err != nil {
+		//只有加载后才设置的env引用会走到这里
+		config.Log(zapcore.WarnLevel, "failed to resolve config", zap.String("key", key), zap.Error(err))
+		return value
+	}
+	return resolved
+}
+
+//返回当前配置的快照, 之后的变更不会反映到快照中, 但可以通过快照订阅变更
 func (v *viperConfig) Sub(key string) config.Config {
-	return &viperConfig{Viper: v.Viper.Sub(key)}
+	sub := v.snapshot().Sub(key)
+	if sub == nil {
+		sub = viper.New()
+	}
+	prefix := key
+	if v.prefix != "" {
+		prefix = v.prefix + "." + key
+	}
+	sources := make(map[string]string)
+	for k, source := range v.Sources() {
+		if strings.HasPrefix(k, strings.ToLower(key)+".") {
+			sources[k[len(key)+1:]] = source
+		}
+	}
+	c := &viperConfig{root: v.rootConfig(), prefix: prefix}
+	c.current.Store(&state{viper: sub, sources: sources})
+	return c
 }
 
 func (v *viperConfig) Unmarshal(obj interface{}) error {
-	return v.Viper.Unmarshal(obj)
+	return decode(v.AllSettings(), obj)
 }
 
 func (v *viperConfig) UnmarshalKey(key string, obj interface{}) error {
-	return v.Viper.UnmarshalKey(key, obj)
+	return decode(v.Get(key), obj)
+}
+
+//与viper的Unmarshal一致
+func decode(input interface{}, obj interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           obj,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(input)
+}
+
+func (v *viperConfig) Watch(key string, fn config.WatchFunc) func() {
+	if v.prefix != "" {
+		key = v.prefix + "." + key
+	}
+	return v.rootConfig().watcher.Watch(key, fn)
+}
+
+//Sub返回的快照订阅到的事件key为完整路径
+func (v *viperConfig) Subscribe() (<-chan config.ChangeEvent, func()) {
+	return v.rootConfig().watcher.Subscribe()
+}
+
+func (v *viperConfig) rootConfig() *viperConfig {
+	if v.root != nil {
+		return v.root
+	}
+	return v
+}
+
+//停止后台的配置监听, 由bootstrap在退出时调用
+func (v *viperConfig) Close() error {
+	if v.root != nil {
+		return nil
+	}
+	v.once.Do(func() {
+		if v.cancel != nil {
+			v.cancel()
+			<-v.done
+		}
+		v.watcher.Close()
+	})
+	return nil
+}
+
+//重新加载所有配置源, 失败时保留当前配置
+func (v *viperConfig) reload(reason string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	next, sources, err := v.loader.load()
+	if err != nil {
+		config.Log(zapcore.ErrorLevel, "failed to reload config", zap.String("reason", reason), zap.Error(err))
+		return
+	}
+	v.resolver.Reset()
+	settings, err := resolveAll(v.resolver, next)
+	if err != nil {
+		config.Log(zapcore.ErrorLevel, "failed to reload config", zap.String("reason", reason), zap.Error(err))
+		return
+	}
+	v.current.Store(&state{viper: next, sources: sources})
+	for _, event := range v.watcher.Update(settings) {
+		config.Log(zapcore.InfoLevel, "config changed", zap.String("reason", reason), zap.String("key", event.Key))
+	}
 }
 
 /*
@@ -37,79 +212,175 @@ Priority:
 	config
 	key/value store
 	default
+本地配置文件与etcd远程配置在后台监听, 变更后整体重新加载并通过Watch/Subscribe通知
 */
 func New() (config.Config, error) {
-	var (
-		v   = viper.New()
-	)
-	v.AutomaticEnv()
-	v.BindPFlags(pflag.CommandLine)
-	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
-
-	env := v.GetString(config.CONF_ENV)
-	configFile := v.GetString(config.CONF_FILE)
-	if configFile != "" {
-		v.SetConfigFile(configFile)
-		if err := v.ReadInConfig(); err != nil {
-			return nil, errs.WithMessagef(err, "failed to load config file:%s\n", configFile)
-		}
-	} else {
-		v.AddConfigPath(".")
-		v.AddConfigPath("config/")
-		v.AddConfigPath("conf/")
-		v.SetConfigName("conf-" + env)
-		if err := v.ReadInConfig(); err != nil {
-			if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-				v.SetConfigName("conf")
-				if err := v.ReadInConfig(); err != nil {
-					if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-						return nil, errs.New("config file not found")
-					}
-					return nil, errs.WithMessagef(err, "failed to load config file:%s\n", v.ConfigFileUsed())
-				}
-			} else {
-				return nil, errs.WithMessagef(err, "failed to load config file:%s\n", v.ConfigFileUsed())
-			}
-		}
+	//通常由bootstrap/command解析, 直接调用New时在此解析
+	if !pflag.CommandLine.Parsed() {
+		pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+		pflag.Parse()
+	}
+	base := newViper()
+	env := base.GetString(config.CONF_ENV)
+	p, err := findProfile(base.GetString(config.CONF_FILE), env)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Printf("read config file: %s\n", v.ConfigFileUsed())
 
-	if env == config.ENV_DEV {
-		v.WatchConfig()
+	l := &loader{profile: p}
+	v, sources, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range l.files {
+		config.Log(zapcore.InfoLevel, "read config file", zap.String("file", file))
 	}
 
-	if v.IsSet("config.etcd.addrs") && v.IsSet("config.etcd.path") {
-		etcdAddrs := v.GetStringSlice("config.etcd.addrs")
-		etcdCfgPath := v.GetString("config.etcd.path")
-		for _, etcdAddr := range etcdAddrs {
-			v.AddRemoteProvider("etcd", etcdAddr, etcdCfgPath)
+	if v.IsSet(CONF_ETCD+".addrs") && v.IsSet(CONF_ETCD+".path") {
+		r, err := newRemote(v)
+		if err != nil {
+			return nil, err
 		}
-		etcdCfgType := "yml"
-		if v.IsSet("config.etcd.type") {
-			etcdCfgType = v.GetString("config.etcd.type")
-		} else if strings.Contains(etcdCfgPath, ".") {
-			etcdCfgType = etcdCfgPath[strings.LastIndex(etcdCfgPath, ".")+1:]
+		if err := r.load(); err != nil {
+			return nil, err
 		}
-		v.GetString(strings.TrimSpace(etcdCfgType))
-		err := v.ReadRemoteConfig()
+		config.Log(zapcore.InfoLevel, "read remote etcd config",
+			zap.Strings("addrs", r.options.Addrs), zap.String("path", r.options.Path), zap.String("type", r.options.Type))
+		l.remotes = append(l.remotes, r)
+	}
+	if v.IsSet(centercfg.CONF_CENTER + ".url") {
+		c, err := newCenter(v)
 		if err != nil {
 			return nil, err
 		}
-		fmt.Printf("read remote etcd config: %s, %s, %s\n", etcdAddrs, etcdCfgPath, etcdCfgType)
-
-		if env == config.ENV_DEV {
-			for {
-				time.Sleep(5 * time.Second)
-				err := v.WatchRemoteConfig()
-				if err != nil {
-					fmt.Printf("failed to read remote config")
-					continue
-				}
-			}
+		config.Log(zapcore.InfoLevel, "read config center", zap.String("url", v.GetString(centercfg.CONF_CENTER+".url")))
+		l.remotes = append(l.remotes, c)
+	}
+	if len(l.remotes) > 0 {
+		if v, sources, err = l.load(); err != nil {
+			return nil, err
 		}
 	}
 
-	return &viperConfig{Viper: v}, nil
+	resolver := config.NewResolver()
+	settings, err := resolveAll(resolver, v)
+	if err != nil {
+		return nil, err
+	}
+	c := &viperConfig{loader: l, resolver: resolver, watcher: config.NewWatcher(settings)}
+	c.current.Store(&state{viper: v, sources: sources})
+	if err := c.watch(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//基于内存中的配置构建, 不读取flag/env/文件, 用于测试
+func NewFromSettings(settings map[string]interface{}) (config.Config, error) {
+	in, err := yaml.Marshal(settings)
+	if err != nil {
+		return nil, errs.WithMessage(err, "invalid config settings")
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(in)); err != nil {
+		return nil, errs.WithMessage(err, "failed to load config settings")
+	}
+	resolver := config.NewResolver()
+	resolved, err := resolveAll(resolver, v)
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]string)
+	for key := range config.Flatten(v.AllSettings()) {
+		sources[key] = config.SOURCE_SETTINGS
+	}
+	c := &viperConfig{resolver: resolver, watcher: config.NewWatcher(resolved)}
+	c.current.Store(&state{viper: v, sources: sources})
+	return c, nil
+}
+
+//加载时校验所有secret引用都可以解析
+func resolveAll(resolver *config.Resolver, v *viper.Viper) (map[string]interface{}, error) {
+	settings, err := resolver.ResolveAll(v.AllSettings())
+	if err != nil {
+		return nil, errs.WithMessage(err, "failed to resolve config secrets")
+	}
+	return settings.(map[string]interface{}), nil
+}
+
+//flag与env, 优先级高于配置文件
+func newViper() *viper.Viper {
+	v := viper.New()
+	v.AutomaticEnv()
+	v.BindPFlags(pflag.CommandLine)
+	v.SetEnvKeyReplacer(envKeyReplacer)
+	return v
+}
+
+//按优先级合并各配置源, 每次加载都重新查找配置文件并构建新的viper
+type loader struct {
+	profile *profile
+	remotes []remoteSource //etcd, 配置中心, 按优先级从低到高
+	files   []string       //上一次加载读取的文件
+}
+
+func (l *loader) load() (*viper.Viper, map[string]string, error) {
+	layers := make([]layer, 0, 4)
+	for _, remote := range l.remotes {
+		layers = append(layers, remote.layers()...)
+	}
+	fileLayers, files, err := l.profile.read()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(fileLayers) == 0 {
+		return nil, nil, errs.New("config file not found")
+	}
+	layers = append(layers, fileLayers...)
+
+	var settings map[string]interface{}
+	for _, layer := range layers {
+		settings = config.Merge(settings, layer.settings)
+	}
+	v, err := build(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	l.files = files
+	return v, sources(v, layers), nil
+}
+
+//需要监听的文件, 包括尚未创建的各层文件
+func (l *loader) watched() map[string]bool {
+	watched := make(map[string]bool)
+	for _, file := range l.profile.candidates() {
+		watched[filepath.Clean(file)] = true
+	}
+	for _, file := range l.files {
+		watched[filepath.Clean(file)] = true
+	}
+	return watched
+}
+
+//用于在加载完成前读取配置选项, 例如etcd与配置中心的连接参数
+func wrap(v *viper.Viper) config.Config {
+	c := &viperConfig{resolver: config.NewResolver()}
+	c.current.Store(&state{viper: v})
+	return c
+}
+
+func build(settings map[string]interface{}) (*viper.Viper, error) {
+	in, err := yaml.Marshal(settings)
+	if err != nil {
+		return nil, errs.WithMessage(err, "invalid config settings")
+	}
+	v := newViper()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(in)); err != nil {
+		return nil, errs.WithMessage(err, "failed to load config settings")
+	}
+	return v, nil
 }
 
 var ProviderSet = wire.NewSet(New)
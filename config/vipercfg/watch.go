@@ -0,0 +1,307 @@
+package vipercfg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/config/centercfg"
+	errs "github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//远程配置源, 优先级低于本地配置文件, 变更时通过notify触发重新加载
+type remoteSource interface {
+	layers() []layer
+	run(ctx context.Context, notify func(reason string))
+}
+
+const CONF_ETCD = "config.etcd"
+
+type RemoteOptions struct {
+	Addrs       []string      `required:"true"`
+	Path        string        `required:"true"`
+	Type        string        //默认取path的扩展名, 否则为yml
+	Interval    time.Duration `default:"5s" min:"1s"`     //轮询间隔
+	SnapshotDir string        `default:"config-snapshot"` //本地快照目录, etcd不可用时从快照启动
+}
+
+func init() {
+	config.RegisterSchema(CONF_ETCD, RemoteOptions{})
+}
+
+//etcd远程配置, 优先级低于本地配置文件
+type remote struct {
+	options    *RemoteOptions
+	providers  []viper.RemoteProvider
+	snapshot   *config.Snapshot
+	mu         sync.Mutex
+	raw        []byte
+	settings   map[string]interface{}
+	snapshotAt time.Time //从快照加载时为快照的保存时间
+}
+
+type remoteSnapshot struct {
+	Type string `json:"type"`
+	Raw  string `json:"raw"`
+}
+
+type remoteProvider struct {
+	provider string
+	endpoint string
+	path     string
+}
+
+func (p remoteProvider) Provider() string      { return p.provider }
+func (p remoteProvider) Endpoint() string      { return p.endpoint }
+func (p remoteProvider) Path() string          { return p.path }
+func (p remoteProvider) SecretKeyring() string { return "" }
+
+func newRemote(v *viper.Viper) (*remote, error) {
+	o := &RemoteOptions{}
+	if err := config.Bind(wrap(v), CONF_ETCD, o); err != nil {
+		return nil, err
+	}
+	if o.Type == "" {
+		o.Type = "yml"
+		if strings.Contains(o.Path, ".") {
+			o.Type = o.Path[strings.LastIndex(o.Path, ".")+1:]
+		}
+	}
+	o.Type = strings.TrimSpace(o.Type)
+	name := "etcd-" + strings.Trim(strings.NewReplacer("/", "_", "\\", "_").Replace(o.Path), "_") + ".json"
+	r := &remote{options: o, snapshot: config.NewSnapshot(filepath.Join(o.SnapshotDir, name))}
+	for _, addr := range o.Addrs {
+		r.providers = append(r.providers, remoteProvider{provider: "etcd", endpoint: addr, path: o.Path})
+	}
+	return r, nil
+}
+
+//启动时读取, etcd不可用时从本地快照加载
+func (r *remote) load() error {
+	_, err := r.fetch()
+	if err == nil {
+		return nil
+	}
+	var snapshot remoteSnapshot
+	savedAt, snapshotErr := r.snapshot.Load(&snapshot)
+	if snapshotErr != nil {
+		return errs.WithMessage(err, fmt.Sprintf("etcd is unavailable and %v", snapshotErr))
+	}
+	settings, parseErr := parseRemote(snapshot.Type, []byte(snapshot.Raw))
+	if parseErr != nil {
+		return errs.WithMessage(parseErr, fmt.Sprintf("invalid config snapshot %s", r.snapshot.Path()))
+	}
+	r.mu.Lock()
+	r.raw = []byte(snapshot.Raw)
+	r.settings = settings
+	r.snapshotAt = savedAt
+	r.mu.Unlock()
+	config.Log(zapcore.WarnLevel, "remote etcd config is unavailable, started from snapshot",
+		zap.String("snapshot", r.snapshot.Path()), zap.Time("savedAt", savedAt), zap.Error(err))
+	return nil
+}
+
+//依次尝试各etcd地址, 返回配置是否变更, 读取成功后保存本地快照
+func (r *remote) fetch() (bool, error) {
+	var lastErr error
+	for _, provider := range r.providers {
+		reader, err := viper.RemoteConfig.Get(provider)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		raw, err := ioutil.ReadAll(reader)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if !r.snapshotAt.IsZero() {
+			config.Log(zapcore.InfoLevel, "remote etcd config is available again, switched from snapshot", zap.String("snapshot", r.snapshot.Path()))
+			r.snapshotAt = time.Time{}
+		}
+		if r.settings != nil && bytes.Equal(raw, r.raw) {
+			return false, nil
+		}
+		settings, err := parseRemote(r.options.Type, raw)
+		if err != nil {
+			return false, errs.WithMessage(err, fmt.Sprintf("invalid remote config %s", r.options.Path))
+		}
+		r.raw = raw
+		r.settings = settings
+		if err := r.snapshot.Save(remoteSnapshot{Type: r.options.Type, Raw: string(raw)}); err != nil {
+			config.Log(zapcore.WarnLevel, "failed to save remote etcd config snapshot", zap.Error(err))
+		}
+		return true, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no remote config provider")
+	}
+	return false, errs.WithMessage(lastErr, fmt.Sprintf("failed to read remote config %s", r.options.Path))
+}
+
+func parseRemote(configType string, raw []byte) (map[string]interface{}, error) {
+	v := viper.New()
+	v.SetConfigType(configType)
+	if err := v.ReadConfig(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return v.AllSettings(), nil
+}
+
+func (r *remote) layers() []layer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return []layer{{source: "etcd:" + r.options.Path, settings: r.settings}}
+}
+
+func (r *remote) run(ctx context.Context, notify func(reason string)) {
+	ticker := time.NewTicker(r.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.fetch()
+			if err != nil {
+				config.Log(zapcore.WarnLevel, "failed to fetch remote etcd config", zap.Error(err))
+				continue
+			}
+			if changed {
+				notify("remote " + r.options.Path)
+			}
+		}
+	}
+}
+
+//配置中心, 每个namespace作为一层
+type center struct {
+	client *centercfg.Client
+	name   string
+}
+
+func newCenter(v *viper.Viper) (*center, error) {
+	o, err := centercfg.NewOptions(wrap(v))
+	if err != nil {
+		return nil, err
+	}
+	client := centercfg.NewClient(o, nil)
+	if err := client.Load(context.Background()); err != nil {
+		return nil, err
+	}
+	return &center{client: client, name: o.App}, nil
+}
+
+func (c *center) layers() []layer {
+	namespaces := c.client.Namespaces()
+	layers := make([]layer, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		layers = append(layers, layer{source: "center:" + c.name + "/" + namespace.Name, settings: namespace.Settings})
+	}
+	return layers
+}
+
+func (c *center) run(ctx context.Context, notify func(reason string)) {
+	c.client.Watch(ctx, func() {
+		notify("config center")
+	})
+}
+
+//后台监听各层配置文件与远程配置, Close时退出
+func (v *viperConfig) watch() error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errs.WithMessage(err, "failed to watch config file")
+	}
+	if err := watchDirs(fw, v.loader.watched()); err != nil {
+		fw.Close()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	v.cancel = cancel
+	v.done = make(chan struct{})
+	changes := make(chan string, 1)
+	notify := func(reason string) {
+		select {
+		case changes <- reason:
+		case <-ctx.Done():
+		}
+	}
+	var wg sync.WaitGroup
+	for _, source := range v.loader.remotes {
+		wg.Add(1)
+		go func(source remoteSource) {
+			defer wg.Done()
+			source.run(ctx, notify)
+		}(source)
+	}
+	go func() {
+		defer close(v.done)
+		defer wg.Wait()
+		defer fw.Close()
+		v.loop(ctx, fw, changes)
+	}()
+	return nil
+}
+
+//监听文件所在目录以支持编辑器的rename/atomic save及新建的文件, 目录不存在时忽略
+func watchDirs(fw *fsnotify.Watcher, files map[string]bool) error {
+	dirs := make(map[string]bool)
+	for file := range files {
+		dirs[filepath.Dir(file)] = true
+	}
+	for dir := range dirs {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := fw.Add(dir); err != nil {
+			return errs.WithMessage(err, fmt.Sprintf("failed to watch config dir:%s", dir))
+		}
+	}
+	return nil
+}
+
+func (v *viperConfig) loop(ctx context.Context, fw *fsnotify.Watcher, changes <-chan string) {
+	watched := v.loader.watched()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-fw.Events:
+			if !ok {
+				return
+			}
+			file := filepath.Clean(event.Name)
+			if !watched[file] || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			v.reload("file " + file)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return
+			}
+			config.Log(zapcore.WarnLevel, "config file watcher error", zap.Error(err))
+		case reason := <-changes:
+			v.reload(reason)
+		}
+		//include的文件可能变化
+		watched = v.loader.watched()
+		if err := watchDirs(fw, watched); err != nil {
+			config.Log(zapcore.WarnLevel, "failed to watch config files", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//单个配置项的变更, Key为叶子节点的完整路径(小写), 新增时Old为nil, 删除时New为nil
+type ChangeEvent struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+//old/new为key对应的值, key为配置段时是map
+type WatchFunc func(old, new interface{})
+
+//订阅channel的缓冲大小, 消费过慢时丢弃事件, 不阻塞配置的重新加载
+const WATCH_CHANNEL_SIZE = 64
+
+//配置变更的订阅管理, 由Config的实现在重新加载配置后调用Update, 通过与上一次配置对比得到变更
+type Watcher struct {
+	mu       sync.Mutex
+	settings map[string]interface{}
+	seq      int
+	watches  map[int]*watch
+	subs     map[int]chan ChangeEvent
+	closed   bool
+}
+
+type watch struct {
+	key string
+	fn  WatchFunc
+}
+
+func NewWatcher(settings map[string]interface{}) *Watcher {
+	return &Watcher{
+		settings: settings,
+		watches:  make(map[int]*watch),
+		subs:     make(map[int]chan ChangeEvent),
+	}
+}
+
+//key及其子配置项变更时回调, 回调在重新加载配置的goroutine中按注册顺序执行, 返回取消函数
+func (w *Watcher) Watch(key string, fn WatchFunc) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	id := w.seq
+	w.watches[id] = &watch{key: strings.ToLower(key), fn: fn}
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.watches, id)
+	}
+}
+
+//订阅所有变更事件, 取消或Close后channel被关闭
+func (w *Watcher) Subscribe() (<-chan ChangeEvent, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ch := make(chan ChangeEvent, WATCH_CHANNEL_SIZE)
+	if w.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	w.seq++
+	id := w.seq
+	w.subs[id] = ch
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if sub, ok := w.subs[id]; ok {
+			delete(w.subs, id)
+			close(sub)
+		}
+	}
+}
+
+//替换为新的配置并通知变更, 返回变更列表
+func (w *Watcher) Update(settings map[string]interface{}) []ChangeEvent {
+	w.mu.Lock()
+	old := w.settings
+	w.settings = settings
+	events := Diff(old, settings)
+	if len(events) == 0 || w.closed {
+		w.mu.Unlock()
+		return events
+	}
+	ids := make([]int, 0, len(w.watches))
+	for id := range w.watches {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	watches := make([]*watch, 0, len(ids))
+	for _, id := range ids {
+		watches = append(watches, w.watches[id])
+	}
+	for _, sub := range w.subs {
+		for _, event := range events {
+			select {
+			case sub <- event:
+			default:
+				Log(zapcore.WarnLevel, "config change event dropped, subscriber is too slow", zap.String("key", event.Key))
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	for _, watch := range watches {
+		if affected(watch.key, events) {
+			notify(watch, Lookup(old, watch.key), Lookup(settings, watch.key))
+		}
+	}
+	return events
+}
+
+//关闭所有订阅channel, 之后的Update不再通知
+func (w *Watcher) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	for id, sub := range w.subs {
+		delete(w.subs, id)
+		close(sub)
+	}
+}
+
+func notify(watch *watch, old, new interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			Log(zapcore.ErrorLevel, "config watch panic", zap.String("key", watch.key), zap.Any("panic", r))
+		}
+	}()
+	watch.fn(old, new)
+}
+
+func affected(key string, events []ChangeEvent) bool {
+	for _, event := range events {
+		if event.Key == key || strings.HasPrefix(event.Key, key+".") || strings.HasPrefix(key, event.Key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+//对比两份配置, 返回按key排序的叶子节点变更, list作为整体对比
+func Diff(old, new map[string]interface{}) []ChangeEvent {
+	oldLeaves := Flatten(old)
+	newLeaves := Flatten(new)
+	events := make([]ChangeEvent, 0)
+	for key, ov := range oldLeaves {
+		nv, ok := newLeaves[key]
+		if !ok {
+			events = append(events, ChangeEvent{Key: key, Old: ov})
+		} else if !reflect.DeepEqual(ov, nv) {
+			events = append(events, ChangeEvent{Key: key, Old: ov, New: nv})
+		}
+	}
+	for key, nv := range newLeaves {
+		if _, ok := oldLeaves[key]; !ok {
+			events = append(events, ChangeEvent{Key: key, New: nv})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
+
+//将嵌套的配置展开为"a.b.c"形式的叶子节点, key统一小写
+func Flatten(settings map[string]interface{}) map[string]interface{} {
+	leaves := make(map[string]interface{})
+	flatten(leaves, "", settings)
+	return leaves
+}
+
+func flatten(leaves map[string]interface{}, prefix string, value interface{}) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		for k, v := range m {
+			flatten(leaves, join(prefix, k), v)
+		}
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			flatten(leaves, join(prefix, fmt.Sprint(k)), v)
+		}
+	default:
+		if prefix != "" {
+			leaves[prefix] = value
+		}
+	}
+}
+
+func join(prefix, key string) string {
+	key = strings.ToLower(key)
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+//按"a.b.c"路径读取嵌套配置, 不存在时返回nil
+func Lookup(settings map[string]interface{}, key string) interface{} {
+	var value interface{} = settings
+	for _, part := range strings.Split(strings.ToLower(key), ".") {
+		switch m := value.(type) {
+		case map[string]interface{}:
+			value = lookupKey(m, part)
+		case map[interface{}]interface{}:
+			value = nil
+			for k, v := range m {
+				if strings.ToLower(fmt.Sprint(k)) == part {
+					value = v
+				}
+			}
+		default:
+			return nil
+		}
+		if value == nil {
+			return nil
+		}
+	}
+	return value
+}
+
+func lookupKey(m map[string]interface{}, key string) interface{} {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.ToLower(k) == key {
+			return v
+		}
+	}
+	return nil
+}
+
+//将src深度合并到dst, map逐层合并, 其余类型(包括list)整体替换
+func Merge(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = make(map[string]interface{}, len(src))
+	}
+	for k, sv := range src {
+		key := strings.ToLower(k)
+		if sm, ok := toStringMap(sv); ok {
+			if dm, ok := toStringMap(dst[key]); ok {
+				dst[key] = Merge(dm, sm)
+				continue
+			}
+			dst[key] = Merge(nil, sm)
+			continue
+		}
+		dst[key] = sv
+	}
+	return dst
+}
+
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		sm := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			sm[fmt.Sprint(k)] = v
+		}
+		return sm, true
+	}
+	return nil, false
+}
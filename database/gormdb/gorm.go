@@ -1,48 +1,45 @@
 package gormdb
 
 import (
+	"context"
+	"github.com/liuliliujian/go-infra-com/bootstrap"
 	"github.com/liuliliujian/go-infra-com/config"
-	"errors"
+	"github.com/liuliliujian/go-infra-com/health"
+	"github.com/liuliliujian/go-infra-com/log/zaplog"
 	"github.com/google/wire"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
 	errs "github.com/pkg/errors"
 	"github.com/wantedly/gorm-zap"
 	"go.uber.org/zap"
-	"strings"
 	"time"
 )
 
 type Options struct {
-	URL               string
-	MaxConns          int
-	MaxIdleConns      int
-	MaxConnLifetime   time.Duration
-	BlockGlobalUpdate bool
+	Dialect           string        `default:"mysql"` //其他dialect需自行import, 例如 _ "github.com/jinzhu/gorm/dialects/sqlite"
+	URL               string        `required:"true"`
+	MaxConns          int           `default:"10" min:"1"`
+	MaxIdleConns      int           `default:"2" min:"0"`
+	MaxConnLifetime   time.Duration `default:"1h" min:"0s"`
+	BlockGlobalUpdate bool          `default:"true"`
 	Debug             bool
 }
 
+func init() {
+	config.RegisterSchema("db", Options{})
+}
+
 func NewOptions(c config.Config, logger *zap.Logger) (*Options, error) {
-	o := &Options{
-		MaxConns:          10,
-		MaxIdleConns:      2,
-		MaxConnLifetime:   time.Hour,
-		BlockGlobalUpdate: true,
-		Debug:             false,
-	}
-	if err := c.UnmarshalKey("db", o); err != nil {
-		return nil, errs.WithMessage(err, "invalid db config options")
+	o := &Options{}
+	if err := config.Bind(c, "db", o); err != nil {
+		return nil, err
 	}
-	if strings.TrimSpace(o.URL) == "" {
-		return nil, errors.New("database url config option must be supplied")
-	}
-	logger.Info("load database options success", zap.String("url", mysqlCoveredURL(o)))
+	logger.Info("load database options success", zap.String("url", config.RedactDSN(o.URL)))
 	return o, nil
 }
 
-func New(o *Options, logger *zap.Logger) (*gorm.DB, error) {
-	//todo 考虑如何将dialect提取成配置，以便通用，那样的话相应db的dialect需要用户自行加载，有没有办法动态加载???
-	db, err := gorm.Open("mysql", o.URL)
+func New(o *Options, logger *zap.Logger, checks *health.Registry) (*gorm.DB, error) {
+	db, err := gorm.Open(o.Dialect, o.URL)
 	if err != nil {
 		return nil, errs.WithMessage(err, "failed to open db connection")
 	}
@@ -57,17 +54,48 @@ func New(o *Options, logger *zap.Logger) (*gorm.DB, error) {
 	db.DB().SetMaxOpenConns(o.MaxConns)
 	db.DB().SetMaxIdleConns(o.MaxIdleConns)
 	db.DB().SetConnMaxLifetime(o.MaxConnLifetime)
+	if err := checks.Register(health.Check{Name: "db", Critical: true, Checker: dbChecker(db)}); err != nil {
+		return nil, err
+	}
 	//todo add monitor middleware
-	//notice: graceful close db pool in app's code
 	return db, nil
 }
 
-func mysqlCoveredURL(o *Options) string {
-	colonIdx := strings.Index(o.URL, ":")
-	if colonIdx == -1 {
-		return o.URL
+//应用退出时关闭连接池, 在组件停止后执行, 此时不再有请求使用db
+func NewShutdownHook(db *gorm.DB) bootstrap.ShutdownHook {
+	return bootstrap.ShutdownHook{Name: "db", Func: func(ctx context.Context) error {
+		return db.Close()
+	}}
+}
+
+//ping db并返回连接池状态
+func dbChecker(db *gorm.DB) health.CheckerFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		stats := db.DB().Stats()
+		detail := map[string]interface{}{
+			"maxOpenConns": stats.MaxOpenConnections,
+			"openConns":    stats.OpenConnections,
+			"inUse":        stats.InUse,
+			"idle":         stats.Idle,
+			"waitCount":    stats.WaitCount,
+			"waitDuration": stats.WaitDuration.String(),
+		}
+		return detail, db.DB().PingContext(ctx)
+	}
+}
+
+const CONTEXT_KEY = "gormdb:context"
+
+//返回使用context中logger的db, SQL日志带有request id、trace id等关联字段, context中没有logger时返回db本身
+//gorm v1不支持context, 需要在每次请求中调用, 例如 gormdb.WithContext(ctx, db).Where(...).Find(&users)
+func WithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	logger := zaplog.FromContextOr(ctx, nil)
+	if logger == nil {
+		return db
 	}
-	return o.URL[:colonIdx] + ":***" + o.URL[colonIdx + 1:]
+	tx := db.Set(CONTEXT_KEY, ctx)
+	tx.SetLogger(gormzap.New(logger))
+	return tx
 }
 
 var ProviderSet = wire.NewSet(New, NewOptions)
\ No newline at end of file
@@ -0,0 +1,246 @@
+/*
+基于配置的特性开关, 定义在本地配置或配置中心的featureflags下, 配置变更后自动生效
+
+	featureflags:
+	  new-checkout:
+	    enabled: true
+	    rollout: 30            #按用户(没有用户时按租户)稳定分桶的开启比例, 0-100, 默认100
+	    users: [u1001]         #总是开启的用户
+	    tenants: [t01]         #总是开启的租户
+	    attributes:            #要求请求属性匹配, 每个属性满足任一值
+	      region: [cn, sg]
+	  checkout-layout:
+	    enabled: true
+	    variants: {control: 50, compact: 50} #变体及权重, 开启时按用户稳定分配
+	    default: control                     #未开启时的变体
+
+flag名称、属性名与变体名不区分大小写, 统一为小写
+*/
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/wire"
+	"github.com/liuliliujian/go-infra-com/config"
+	"go.uber.org/zap"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	CONF_FEATURE_FLAGS = "featureflags"
+	VARIANT_ON         = "on"  //开启且未配置variants时的变体
+	VARIANT_OFF        = "off" //未开启且未配置default时的变体
+)
+
+type Flag struct {
+	Enabled    bool
+	Rollout    int `min:"0" max:"100"` //未配置时为100
+	Users      []string
+	Tenants    []string
+	Attributes map[string][]string
+	Variants   map[string]int
+	Default    string `default:"off"`
+}
+
+func init() {
+	config.RegisterSchema(CONF_FEATURE_FLAGS, map[string]Flag{})
+}
+
+//请求的评估目标, 由gin/micro的中间件从请求中解析后放入context
+type Target struct {
+	UserID     string
+	TenantID   string
+	Attributes map[string]string
+}
+
+type targetKey struct{}
+
+func WithTarget(ctx context.Context, target Target) context.Context {
+	return context.WithValue(ctx, targetKey{}, target)
+}
+
+func TargetFrom(ctx context.Context) (Target, bool) {
+	target, ok := ctx.Value(targetKey{}).(Target)
+	return target, ok
+}
+
+//bucket的key, 优先使用用户
+func (t Target) key() string {
+	if t.UserID != "" {
+		return "user:" + t.UserID
+	}
+	if t.TenantID != "" {
+		return "tenant:" + t.TenantID
+	}
+	return ""
+}
+
+type Flags struct {
+	logger *zap.Logger
+	flags  atomic.Value //map[string]*Flag
+	cancel func()
+}
+
+//读取featureflags并监听变更, 变更后的配置不合法时保留原有的flag
+func New(c config.Config, logger *zap.Logger) (*Flags, error) {
+	flags, err := load(c)
+	if err != nil {
+		return nil, err
+	}
+	f := &Flags{logger: logger}
+	f.flags.Store(flags)
+	f.cancel = c.Watch(CONF_FEATURE_FLAGS, func(old, new interface{}) {
+		flags, err := load(c)
+		if err != nil {
+			logger.Error("failed to reload feature flags, keep current flags", zap.Error(err))
+			return
+		}
+		f.flags.Store(flags)
+		logger.Info("feature flags reloaded", zap.Int("count", len(flags)))
+	})
+	return f, nil
+}
+
+func load(c config.Config) (map[string]*Flag, error) {
+	flags := make(map[string]*Flag)
+	for name := range c.GetStringMap(CONF_FEATURE_FLAGS) {
+		key := CONF_FEATURE_FLAGS + "." + name
+		flag := &Flag{}
+		if err := config.Bind(c, key, flag); err != nil {
+			return nil, err
+		}
+		if !c.IsSet(key + ".rollout") {
+			flag.Rollout = 100
+		}
+		for variant, weight := range flag.Variants {
+			if weight < 0 {
+				return nil, &config.BindError{Key: key, Fields: []config.FieldError{
+					{Key: key + ".variants." + variant, Message: fmt.Sprintf("must be >= 0, but got %d", weight)},
+				}}
+			}
+		}
+		flags[strings.ToLower(name)] = flag
+	}
+	return flags, nil
+}
+
+//停止监听配置变更
+func (f *Flags) Close() {
+	f.cancel()
+}
+
+//当前生效的flag, 不存在时返回nil
+func (f *Flags) Get(name string) *Flag {
+	return f.flags.Load().(map[string]*Flag)[strings.ToLower(name)]
+}
+
+//使用context中的Target评估, 不存在的flag视为关闭
+func (f *Flags) Enabled(ctx context.Context, name string) bool {
+	target, _ := TargetFrom(ctx)
+	return f.EnabledFor(target, name)
+}
+
+func (f *Flags) EnabledFor(target Target, name string) bool {
+	flag := f.Get(name)
+	return flag != nil && flag.enabled(strings.ToLower(name), target)
+}
+
+//开启时返回按权重分配的变体, 否则返回default
+func (f *Flags) Variant(ctx context.Context, name string) string {
+	target, _ := TargetFrom(ctx)
+	return f.VariantFor(target, name)
+}
+
+func (f *Flags) VariantFor(target Target, name string) string {
+	flag := f.Get(name)
+	if flag == nil {
+		return VARIANT_OFF
+	}
+	name = strings.ToLower(name)
+	if !flag.enabled(name, target) {
+		return flag.Default
+	}
+	return flag.variant(name, target)
+}
+
+func (f *Flag) enabled(name string, target Target) bool {
+	if !f.Enabled {
+		return false
+	}
+	if contains(f.Users, target.UserID) || contains(f.Tenants, target.TenantID) {
+		return true
+	}
+	for attribute, values := range f.Attributes {
+		if !contains(values, lookup(target.Attributes, attribute)) {
+			return false
+		}
+	}
+	if f.Rollout >= 100 {
+		return true
+	}
+	key := target.key()
+	if key == "" {
+		return false
+	}
+	return bucket(name+"/rollout/"+key, 100) < uint32(f.Rollout)
+}
+
+func (f *Flag) variant(name string, target Target) string {
+	variants := make([]string, 0, len(f.Variants))
+	total := 0
+	for variant, weight := range f.Variants {
+		if weight > 0 {
+			variants = append(variants, variant)
+			total += weight
+		}
+	}
+	if total == 0 {
+		return VARIANT_ON
+	}
+	sort.Strings(variants)
+	n := int(bucket(name+"/variant/"+target.key(), uint32(total)))
+	for _, variant := range variants {
+		n -= f.Variants[variant]
+		if n < 0 {
+			return variant
+		}
+	}
+	return variants[len(variants)-1]
+}
+
+//同一个key总是落在同一个bucket, 不同flag之间相互独立
+func bucket(key string, n uint32) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % n
+}
+
+func contains(values []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func lookup(attributes map[string]string, key string) string {
+	if value, ok := attributes[key]; ok {
+		return value
+	}
+	for k, v := range attributes {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+var ProviderSet = wire.NewSet(New)
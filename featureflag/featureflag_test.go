@@ -0,0 +1,193 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/config/vipercfg"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func newFlags(t *testing.T, flags map[string]interface{}) *Flags {
+	c, err := vipercfg.NewFromSettings(map[string]interface{}{CONF_FEATURE_FLAGS: flags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(c, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func user(i int) Target {
+	return Target{UserID: fmt.Sprintf("u%d", i)}
+}
+
+func TestBucketDeterministic(t *testing.T) {
+	f := newFlags(t, map[string]interface{}{
+		"half":  map[string]interface{}{"enabled": true, "rollout": 50},
+		"other": map[string]interface{}{"enabled": true, "rollout": 50},
+	})
+	same := 0
+	for i := 0; i < 1000; i++ {
+		enabled := f.EnabledFor(user(i), "half")
+		for j := 0; j < 3; j++ {
+			if f.EnabledFor(user(i), "HALF") != enabled {
+				t.Fatalf("expect the same result for user %d", i)
+			}
+		}
+		if f.EnabledFor(user(i), "other") == enabled {
+			same++
+		}
+	}
+	//不同flag独立分桶
+	if same == 1000 || same == 0 {
+		t.Fatalf("expect flags bucketed independently, but got %d same results", same)
+	}
+}
+
+func TestRollout(t *testing.T) {
+	f := newFlags(t, map[string]interface{}{
+		"zero":    map[string]interface{}{"enabled": true, "rollout": 0},
+		"full":    map[string]interface{}{"enabled": true, "rollout": 100},
+		"default": map[string]interface{}{"enabled": true},
+		"partial": map[string]interface{}{"enabled": true, "rollout": 30},
+		"off":     map[string]interface{}{"enabled": false, "rollout": 100},
+	})
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		for _, name := range []string{"zero", "full", "default", "partial", "off"} {
+			if f.EnabledFor(user(i), name) {
+				counts[name]++
+			}
+		}
+	}
+	if counts["zero"] != 0 || counts["full"] != 10000 || counts["default"] != 10000 || counts["off"] != 0 {
+		t.Fatalf("unexpected rollout counts: %v", counts)
+	}
+	if counts["partial"] < 2700 || counts["partial"] > 3300 {
+		t.Fatalf("expect about 30%% enabled, but got %d", counts["partial"])
+	}
+	//没有用户与租户时只有100%开启
+	if f.EnabledFor(Target{}, "partial") || !f.EnabledFor(Target{}, "full") {
+		t.Fatal("expect anonymous target enabled only by full rollout")
+	}
+	//按租户分桶
+	tenant := Target{TenantID: "t1"}
+	if f.EnabledFor(tenant, "partial") != f.EnabledFor(Target{TenantID: "t1", Attributes: map[string]string{"a": "b"}}, "partial") {
+		t.Fatal("expect tenant bucketing deterministic")
+	}
+	if f.EnabledFor(user(1), "missing") {
+		t.Fatal("expect missing flag disabled")
+	}
+}
+
+func TestTargetingBeforeRollout(t *testing.T) {
+	f := newFlags(t, map[string]interface{}{
+		"beta": map[string]interface{}{
+			"enabled":    true,
+			"rollout":    0,
+			"users":      []interface{}{"U1001"},
+			"tenants":    []interface{}{"t01"},
+			"attributes": map[string]interface{}{"region": []interface{}{"cn", "sg"}},
+		},
+		"disabled": map[string]interface{}{"enabled": false, "users": []interface{}{"u1001"}},
+	})
+	cases := []struct {
+		target   Target
+		expected bool
+	}{
+		{Target{UserID: "u1001"}, true},
+		{Target{UserID: "u1002", TenantID: "T01"}, true},
+		{Target{UserID: "u1002", Attributes: map[string]string{"Region": "cn"}}, false},
+		{Target{UserID: "u1002"}, false},
+		{Target{}, false},
+	}
+	for _, c := range cases {
+		if actual := f.EnabledFor(c.target, "beta"); actual != c.expected {
+			t.Errorf("target %+v: expect %v, but got %v", c.target, c.expected, actual)
+		}
+	}
+	if f.EnabledFor(Target{UserID: "u1001"}, "disabled") {
+		t.Fatal("expect targeting not override a disabled flag")
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	f := newFlags(t, map[string]interface{}{
+		"regional": map[string]interface{}{
+			"enabled":    true,
+			"attributes": map[string]interface{}{"region": []interface{}{"cn", "sg"}, "plan": []interface{}{"pro"}},
+		},
+	})
+	cases := []struct {
+		attributes map[string]string
+		expected   bool
+	}{
+		{map[string]string{"region": "SG", "Plan": "pro"}, true},
+		{map[string]string{"region": "us", "plan": "pro"}, false},
+		{map[string]string{"region": "cn"}, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if actual := f.EnabledFor(Target{UserID: "u1", Attributes: c.attributes}, "regional"); actual != c.expected {
+			t.Errorf("attributes %v: expect %v, but got %v", c.attributes, c.expected, actual)
+		}
+	}
+}
+
+func TestVariant(t *testing.T) {
+	f := newFlags(t, map[string]interface{}{
+		"layout": map[string]interface{}{
+			"enabled":  true,
+			"variants": map[string]interface{}{"control": 75, "compact": 25, "unused": 0},
+			"default":  "control",
+		},
+		"layout-off": map[string]interface{}{"enabled": false, "variants": map[string]interface{}{"compact": 100}, "default": "control"},
+		"plain":      map[string]interface{}{"enabled": true},
+		"plain-off":  map[string]interface{}{"enabled": false},
+	})
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		variant := f.VariantFor(user(i), "layout")
+		if f.VariantFor(user(i), "layout") != variant {
+			t.Fatalf("expect the same variant for user %d", i)
+		}
+		counts[variant]++
+	}
+	if counts["unused"] != 0 || counts["control"]+counts["compact"] != 10000 || counts["compact"] < 2200 || counts["compact"] > 2800 {
+		t.Fatalf("expect variants by weight, but got %v", counts)
+	}
+	if v := f.VariantFor(user(1), "layout-off"); v != "control" {
+		t.Fatalf("expect default variant when disabled, but got %s", v)
+	}
+	if v := f.VariantFor(user(1), "plain"); v != VARIANT_ON {
+		t.Fatalf("expect on, but got %s", v)
+	}
+	if v := f.VariantFor(user(1), "plain-off"); v != VARIANT_OFF {
+		t.Fatalf("expect off, but got %s", v)
+	}
+	if v := f.VariantFor(user(1), "missing"); v != VARIANT_OFF {
+		t.Fatalf("expect off for missing flag, but got %s", v)
+	}
+	ctx := WithTarget(context.Background(), user(1))
+	if f.Variant(ctx, "layout") != f.VariantFor(user(1), "layout") || !f.Enabled(ctx, "plain") {
+		t.Fatal("expect evaluated with the target in context")
+	}
+}
+
+func TestInvalidFlags(t *testing.T) {
+	for _, flag := range []map[string]interface{}{
+		{"enabled": true, "rollout": 101},
+		{"enabled": true, "variants": map[string]interface{}{"a": -1}},
+	} {
+		c, err := vipercfg.NewFromSettings(map[string]interface{}{CONF_FEATURE_FLAGS: map[string]interface{}{"bad": flag}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := New(c, zap.NewNop()); err == nil {
+			t.Fatalf("expect error for invalid flag %v", flag)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package featureflag
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/liuliliujian/go-infra-com/util/ginutil"
+)
+
+//请求头或micro metadata中的评估目标
+const (
+	HEADER_USER_ID   = "X-User-Id"
+	HEADER_TENANT_ID = "X-Tenant-Id"
+)
+
+//从请求中解析评估目标, 例如从token中解析用户
+type GinTargetFunc func(c *gin.Context) Target
+
+func HeaderTarget(c *gin.Context) Target {
+	return Target{
+		UserID:   c.GetHeader(HEADER_USER_ID),
+		TenantID: c.GetHeader(HEADER_TENANT_ID),
+	}
+}
+
+//将评估目标放入请求的context, extract为nil时使用HeaderTarget
+func GinMiddleware(extract GinTargetFunc) gin.HandlerFunc {
+	if extract == nil {
+		extract = HeaderTarget
+	}
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithTarget(c.Request.Context(), extract(c)))
+		c.Next()
+	}
+}
+
+//flag未开启时接口视为不存在
+func GinRequire(flags *Flags, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !flags.Enabled(c.Request.Context(), name) {
+			ginutil.ApiError(c, ginutil.Status_Api_NotFound, "api not found")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,70 @@
+package featureflag
+
+import (
+	"context"
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/metadata"
+	"github.com/micro/go-micro/server"
+	"strings"
+)
+
+//从请求中解析评估目标, 例如从metadata中的token解析用户
+type MicroTargetFunc func(ctx context.Context, req server.Request) Target
+
+func MetadataTarget(ctx context.Context, req server.Request) Target {
+	md, _ := metadata.FromContext(ctx)
+	return Target{
+		UserID:   get(md, HEADER_USER_ID),
+		TenantID: get(md, HEADER_TENANT_ID),
+	}
+}
+
+//metadata经过http传输后key的大小写可能变化
+func get(md metadata.Metadata, key string) string {
+	if value, ok := md[key]; ok {
+		return value
+	}
+	for k, v := range md {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+//将评估目标放入handler的context, extract为nil时使用MetadataTarget
+func NewHandlerWrapper(extract MicroTargetFunc) server.HandlerWrapper {
+	if extract == nil {
+		extract = MetadataTarget
+	}
+	return func(handlerFunc server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			return handlerFunc(WithTarget(ctx, extract(ctx, req)), req, rsp)
+		}
+	}
+}
+
+type clientWrapper struct {
+	client.Client
+}
+
+//调用下游服务时传递context中的评估目标, 使整条调用链得到一致的结果
+func (c *clientWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	if target, ok := TargetFrom(ctx); ok {
+		md := metadata.Metadata{}
+		if target.UserID != "" {
+			md[HEADER_USER_ID] = target.UserID
+		}
+		if target.TenantID != "" {
+			md[HEADER_TENANT_ID] = target.TenantID
+		}
+		ctx = metadata.MergeContext(ctx, md, false)
+	}
+	return c.Client.Call(ctx, req, rsp, opts...)
+}
+
+func NewClientWrapper() client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &clientWrapper{Client: c}
+	}
+}
@@ -0,0 +1,123 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/metadata"
+	"github.com/micro/go-micro/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	f := newFlags(t, map[string]interface{}{
+		"beta": map[string]interface{}{"enabled": true, "rollout": 0, "users": []interface{}{"u1"}},
+	})
+	router := gin.New()
+	router.Use(GinMiddleware(nil))
+	router.GET("/target", func(c *gin.Context) {
+		target, _ := TargetFrom(c.Request.Context())
+		c.JSON(http.StatusOK, target)
+	})
+	router.GET("/beta", GinRequire(f, "beta"), func(c *gin.Context) {
+		c.String(http.StatusOK, "beta")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/target", nil)
+	req.Header.Set("x-user-id", "u1")
+	req.Header.Set(HEADER_TENANT_ID, "t1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var target Target
+	if err := json.Unmarshal(w.Body.Bytes(), &target); err != nil {
+		t.Fatal(err)
+	}
+	if target.UserID != "u1" || target.TenantID != "t1" {
+		t.Fatalf("expect target from headers, but got %+v", target)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/beta", nil)
+	req.Header.Set(HEADER_USER_ID, "u1")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Body.String() != "beta" {
+		t.Fatalf("expect enabled for u1, but got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/beta", nil)
+	req.Header.Set(HEADER_USER_ID, "u2")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var body struct {
+		Status string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != "40000012" {
+		t.Fatalf("expect api not found for u2, but got %s", w.Body.String())
+	}
+}
+
+func TestGinMiddlewareCustomTarget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware(func(c *gin.Context) Target {
+		return Target{UserID: c.Query("uid"), Attributes: map[string]string{"region": "cn"}}
+	}))
+	var target Target
+	router.GET("/", func(c *gin.Context) {
+		target, _ = TargetFrom(c.Request.Context())
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?uid=u9", nil))
+	if target.UserID != "u9" || target.Attributes["region"] != "cn" {
+		t.Fatalf("expect custom target, but got %+v", target)
+	}
+}
+
+type recordClient struct {
+	client.Client
+	md metadata.Metadata
+}
+
+func (c *recordClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	c.md, _ = metadata.FromContext(ctx)
+	return nil
+}
+
+func TestMicroWrappers(t *testing.T) {
+	recorder := &recordClient{}
+	downstream := NewClientWrapper()(recorder)
+	var target Target
+	handler := NewHandlerWrapper(nil)(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		target, _ = TargetFrom(ctx)
+		return downstream.Call(ctx, nil, nil)
+	})
+	//metadata经过http传输后key的大小写可能变化
+	ctx := metadata.NewContext(context.Background(), metadata.Metadata{"x-user-id": "u1", "X-Tenant-Id": "t1", "Trace": "x"})
+	if err := handler(ctx, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if target.UserID != "u1" || target.TenantID != "t1" {
+		t.Fatalf("expect target from metadata, but got %+v", target)
+	}
+	if recorder.md[HEADER_USER_ID] != "u1" && recorder.md["x-user-id"] != "u1" {
+		t.Fatalf("expect user propagated to downstream, but got %v", recorder.md)
+	}
+	if recorder.md[HEADER_TENANT_ID] != "t1" || recorder.md["Trace"] != "x" {
+		t.Fatalf("expect tenant propagated and metadata kept, but got %v", recorder.md)
+	}
+
+	//没有target时不修改metadata
+	recorder.md = nil
+	if err := downstream.Call(context.Background(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.md) != 0 {
+		t.Fatalf("expect no metadata without target, but got %v", recorder.md)
+	}
+}
@@ -0,0 +1,211 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/config"
+	"sync"
+	"time"
+)
+
+const (
+	STATUS_UP       = "UP"
+	STATUS_DEGRADED = "DEGRADED" //仅非critical检查失败, 实例仍接收流量
+	STATUS_DOWN     = "DOWN"
+)
+
+//依赖检查, 返回的detail会输出到readiness结果中, 例如连接池状态
+type Checker interface {
+	Check(ctx context.Context) (detail interface{}, err error)
+}
+
+type CheckerFunc func(ctx context.Context) (interface{}, error)
+
+func (f CheckerFunc) Check(ctx context.Context) (interface{}, error) {
+	return f(ctx)
+}
+
+type Check struct {
+	Name     string
+	Critical bool          //critical检查失败时实例not ready, 否则仅标记为degraded
+	Timeout  time.Duration //默认使用application.health.timeout
+	Checker  Checker
+}
+
+type Result struct {
+	Status   string      `json:"status"`
+	Critical bool        `json:"critical"`
+	Detail   interface{} `json:"detail,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Duration string      `json:"duration"`
+}
+
+type Report struct {
+	Status    string             `json:"status"`
+	State     string             `json:"state"`
+	CheckedAt *time.Time         `json:"checkedAt,omitempty"`
+	Checks    map[string]*Result `json:"checks,omitempty"`
+}
+
+func (r *Report) Up() bool {
+	return r.Status != STATUS_DOWN
+}
+
+type Options struct {
+	Timeout  time.Duration `default:"2s" min:"1ms"`
+	CacheTTL time.Duration `default:"3s" min:"0s"` //缓存检查结果, 避免探针频繁访问依赖
+}
+
+func init() {
+	config.RegisterSchema(config.CONF_APP_PREF+".health", Options{})
+}
+
+func NewOptions(c config.Config) (*Options, error) {
+	o := &Options{}
+	if err := config.Bind(c, config.CONF_APP_PREF+".health", o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+//依赖检查注册表, 各模块通过wire注入后注册自身的检查
+type Registry struct {
+	options *Options
+	mu      sync.Mutex
+	checks  []Check
+	results map[string]*Result
+	checked time.Time
+}
+
+func NewRegistry(o *Options) *Registry {
+	return &Registry{options: o}
+}
+
+func (r *Registry) Register(check Check) error {
+	if check.Name == "" || check.Checker == nil {
+		return errors.New("health check's name and checker are required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.checks {
+		if c.Name == check.Name {
+			return errors.New(fmt.Sprintf("duplicate health check[%s]", check.Name))
+		}
+	}
+	r.checks = append(r.checks, check)
+	r.results = nil
+	return nil
+}
+
+//非ready状态直接返回DOWN, 否则执行依赖检查, 任一critical检查失败即为DOWN
+func (r *Registry) Readiness(ctx context.Context, status *Status) *Report {
+	state := status.State()
+	if state != StateReady {
+		return &Report{Status: STATUS_DOWN, State: state.String()}
+	}
+	results, checkedAt := r.Run(ctx)
+	report := &Report{Status: STATUS_UP, State: state.String(), Checks: results}
+	if len(results) > 0 {
+		report.CheckedAt = &checkedAt
+	}
+	for _, result := range results {
+		if result.Status == STATUS_UP {
+			continue
+		}
+		if result.Critical {
+			report.Status = STATUS_DOWN
+			break
+		}
+		report.Status = STATUS_DEGRADED
+	}
+	return report
+}
+
+//并发执行所有检查, 结果在CacheTTL内复用, 并发调用共享同一次检查
+//检查不受ctx取消的影响(只使用其中的值), 探针断开连接时不会把所有检查标记为DOWN并缓存, 每个检查只受自身超时约束
+func (r *Registry) Run(ctx context.Context) (map[string]*Result, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.results != nil && time.Since(r.checked) < r.options.CacheTTL {
+		return r.results, r.checked
+	}
+
+	results := make(map[string]*Result, len(r.checks))
+	resultsMu := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for _, check := range r.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := r.runCheck(ctx, check)
+			resultsMu.Lock()
+			results[check.Name] = result
+			resultsMu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+	r.results = results
+	r.checked = time.Now()
+	return r.results, r.checked
+}
+
+func (r *Registry) runCheck(ctx context.Context, check Check) *Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = r.options.Timeout
+	}
+	ctx, cancelFunc := context.WithTimeout(detached{ctx}, timeout)
+	defer cancelFunc()
+
+	type outcome struct {
+		detail interface{}
+		err    error
+	}
+	start := time.Now()
+	done := make(chan outcome, 1)
+	go func() {
+		detail, err := check.Checker.Check(ctx)
+		done <- outcome{detail: detail, err: err}
+	}()
+
+	result := &Result{Status: STATUS_UP, Critical: check.Critical}
+	select {
+	case o := <-done:
+		result.Detail = o.detail
+		if o.err != nil {
+			result.Status = STATUS_DOWN
+			result.Error = o.err.Error()
+		}
+	case <-ctx.Done():
+		result.Status = STATUS_DOWN
+		if ctx.Err() == context.DeadlineExceeded {
+			result.Error = fmt.Sprintf("timeout(%v) waiting for health check", timeout)
+		} else {
+			result.Error = ctx.Err().Error()
+		}
+	}
+	result.Duration = time.Since(start).String()
+	return result
+}
+
+//保留parent中的值, 但不继承其取消与deadline
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (d detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (d detached) Err() error {
+	return nil
+}
+
+func (d detached) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
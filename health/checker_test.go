@@ -0,0 +1,35 @@
+package health
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunIgnoresCallerCancel(t *testing.T) {
+	r := NewRegistry(&Options{Timeout: 50 * time.Millisecond, CacheTTL: time.Minute})
+	r.Register(Check{Name: "db", Critical: true, Checker: CheckerFunc(func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			return "ok", nil
+		}
+	})})
+	r.Register(Check{Name: "slow", Checker: CheckerFunc(func(ctx context.Context) (interface{}, error) {
+		time.Sleep(200 * time.Millisecond) //不响应ctx的检查
+		return nil, nil
+	})})
+
+	//探针已断开连接
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, _ := r.Run(ctx)
+	if results["db"].Status != STATUS_UP {
+		t.Fatalf("expect db UP when caller is gone, but got %+v", results["db"])
+	}
+	if results["slow"].Status != STATUS_DOWN || !strings.Contains(results["slow"].Error, "timeout(50ms)") {
+		t.Fatalf("expect slow check timeout, but got %+v", results["slow"])
+	}
+}
@@ -0,0 +1,86 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/wire"
+	"sync/atomic"
+)
+
+type State int32
+
+const (
+	StateStarting State = iota
+	StateReady
+	StateDraining
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateReady:
+		return "ready"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("unknown(%d)", int32(s))
+	}
+}
+
+//允许的状态流转, starting -> ready -> draining -> stopped, 启动失败时starting -> stopped
+var transitions = map[State][]State{
+	StateStarting: {StateReady, StateStopped},
+	StateReady:    {StateDraining, StateStopped},
+	StateDraining: {StateStopped},
+}
+
+//应用状态, 由bootstrap维护, 供health endpoints读取
+type Status struct {
+	state int32
+}
+
+func NewStatus() *Status {
+	return &Status{state: int32(StateStarting)}
+}
+
+func (s *Status) State() State {
+	return State(atomic.LoadInt32(&s.state))
+}
+
+func (s *Status) Transit(to State) error {
+	for {
+		from := s.State()
+		if from == to {
+			return nil
+		}
+		allowed := false
+		for _, state := range transitions[from] {
+			if state == to {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.New(fmt.Sprintf("illegal application state transition: %s -> %s", from, to))
+		}
+		if atomic.CompareAndSwapInt32(&s.state, int32(from), int32(to)) {
+			return nil
+		}
+	}
+}
+
+//进程存活即为live, 仅用于判断是否需要重启
+func (s *Status) Live() bool {
+	return s.State() != StateStopped
+}
+
+//仅ready状态接收流量, draining时负载均衡摘除实例
+func (s *Status) Ready() bool {
+	return s.State() == StateReady
+}
+
+var ProviderSet = wire.NewSet(NewStatus, NewRegistry, NewOptions)
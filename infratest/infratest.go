@@ -0,0 +1,226 @@
+//进程内集成测试工具, 基于内存配置组装Application, 不依赖mysql/etcd/固定端口:
+//	func TestHello(t *testing.T) {
+//		app, err := infratest.New(infratest.Options{
+//			Settings: map[string]interface{}{"gin.mode": "test"},
+//			GinConfigurer: func(db *gorm.DB) ginhttp.GinModuleConfigurer {
+//				return ginhttp.GinModuleConfigurer{RouterConfigurer: routes(db)}
+//			},
+//		})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		defer app.Cleanup()
+//		resp, err := app.Http.Get(app.URL("/hello"))
+//		...
+//	}
+package infratest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/liuliliujian/go-infra-com/bootstrap"
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/config/vipercfg"
+	"github.com/liuliliujian/go-infra-com/database/gormdb"
+	"github.com/liuliliujian/go-infra-com/health"
+	"github.com/liuliliujian/go-infra-com/log/zaplog"
+	"github.com/liuliliujian/go-infra-com/transport/http/ginhttp"
+	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc"
+	"github.com/micro/go-micro/client"
+	errs "github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var dbSeq int64
+
+type Options struct {
+	//覆盖默认配置, key支持"gin.mode"形式的路径
+	Settings        map[string]interface{}
+	GinConfigurer   func(db *gorm.DB) ginhttp.GinModuleConfigurer
+	MicroConfigurer func(db *gorm.DB) microrpc.MicroModuleConfigurer
+}
+
+type App struct {
+	*bootstrap.Application
+	Config  config.Config
+	Logger  *zap.Logger
+	DB      *gorm.DB
+	BaseURL string
+	Http    *http.Client
+	Rpc     client.Client
+}
+
+//默认使用内存sqlite, 内存micro registry/transport, gin随机端口, 不启用admin server
+func defaultSettings() (map[string]interface{}, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"application": map[string]interface{}{
+			"name":            "infratest",
+			"shutdownTimeout": "10s",
+			"admin":           map[string]interface{}{"enabled": false},
+		},
+		"zap-logs": []interface{}{
+			map[string]interface{}{"filePath": "stderr", "level": "warn"},
+		},
+		"db": map[string]interface{}{
+			"dialect":  "sqlite3",
+			"url":      fmt.Sprintf("file:infratest%d?mode=memory&cache=shared", atomic.AddInt64(&dbSeq, 1)),
+			"maxConns": 1,
+		},
+		"micro": map[string]interface{}{
+			"registry":  microrpc.Registry_Memory,
+			"transport": microrpc.Transport_Memory,
+		},
+		"gin": map[string]interface{}{
+			"port": port,
+			"mode": "test",
+		},
+	}, nil
+}
+
+//启动http/rpc组件, 返回前已ready, 测试结束调用Cleanup
+func New(o Options) (*App, error) {
+	settings, err := defaultSettings()
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range o.Settings {
+		set(settings, strings.Split(key, "."), value)
+	}
+	c, err := vipercfg.NewFromSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	zapOptions, err := zaplog.NewOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := zaplog.New(zapOptions)
+	if err != nil {
+		return nil, err
+	}
+	status := health.NewStatus()
+	healthOptions, err := health.NewOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	checks := health.NewRegistry(healthOptions)
+
+	dbOptions, err := gormdb.NewOptions(c, logger)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gormdb.New(dbOptions, logger, checks)
+	if err != nil {
+		return nil, err
+	}
+	app, err := newApp(o, c, logger, status, checks, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return app, nil
+}
+
+func newApp(o Options, c config.Config, logger *zap.Logger, status *health.Status, checks *health.Registry, db *gorm.DB) (*App, error) {
+	ginConfigurer := ginhttp.GinModuleConfigurer{}
+	if o.GinConfigurer != nil {
+		ginConfigurer = o.GinConfigurer(db)
+	}
+	ginOptions, err := ginhttp.NewOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	router, err := ginhttp.NewRouter(ginOptions, logger, status, checks, ginConfigurer)
+	if err != nil {
+		return nil, err
+	}
+	httpServer, err := ginhttp.NewServer(ginOptions, logger, router)
+	if err != nil {
+		return nil, err
+	}
+
+	microConfigurer := microrpc.MicroModuleConfigurer{}
+	if o.MicroConfigurer != nil {
+		microConfigurer = o.MicroConfigurer(db)
+	}
+	microOptions, err := microrpc.NewOptions(c, logger)
+	if err != nil {
+		return nil, err
+	}
+	service, err := microrpc.NewService(microOptions, logger, microConfigurer, checks)
+	if err != nil {
+		return nil, err
+	}
+	rpcServer, err := microrpc.NewServer(microOptions, logger, service, microConfigurer)
+	if err != nil {
+		return nil, err
+	}
+
+	components := bootstrap.Components{bootstrap.HttpComponent(httpServer), bootstrap.RpcComponent(rpcServer)}
+	hooks := bootstrap.ShutdownHooks{gormdb.NewShutdownHook(db)}
+	application, err := bootstrap.RunComponentApp(c, logger, status, components, hooks)
+	if err != nil {
+		return nil, errs.WithMessage(err, "failed to start test application")
+	}
+	application.HttpServer = httpServer
+	application.RpcServer = rpcServer
+	return &App{
+		Application: application,
+		Config:      c,
+		Logger:      logger,
+		DB:          db,
+		BaseURL:     fmt.Sprintf("http://127.0.0.1:%d", ginOptions.Port),
+		Http:        &http.Client{Timeout: 10 * time.Second},
+		Rpc:         service.Client(),
+	}, nil
+}
+
+func (a *App) URL(path string) string {
+	return a.BaseURL + path
+}
+
+//停止所有组件并关闭db
+func (a *App) Cleanup() error {
+	return a.Shutdown()
+}
+
+//gin的端口需在(0, 60000)之间
+func freePort() (int, error) {
+	for i := 0; i < 10; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, errs.WithMessage(err, "failed to pick free port")
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+		if port < 60000 {
+			return port, nil
+		}
+	}
+	return 0, errors.New("failed to pick free port below 60000")
+}
+
+//按路径设置值, 中间层的map不存在或不是map时创建
+func set(settings map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		sub, ok := settings[key].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			settings[key] = sub
+		}
+		settings = sub
+	}
+	settings[path[len(path)-1]] = value
+}
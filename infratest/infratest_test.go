@@ -0,0 +1,99 @@
+package infratest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"github.com/liuliliujian/go-infra-com/health"
+	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc"
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/server"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type HelloRequest struct {
+	Name string
+}
+
+type HelloResponse struct {
+	Greeting string
+	Users    int
+}
+
+type user struct {
+	ID   int
+	Name string
+}
+
+type Greeter struct {
+	db *gorm.DB
+}
+
+func (g *Greeter) Hello(ctx context.Context, req *HelloRequest, rsp *HelloResponse) error {
+	rsp.Greeting = "hello " + req.Name
+	return g.db.Model(&user{}).Count(&rsp.Users).Error
+}
+
+func TestApp(t *testing.T) {
+	app, err := New(Options{
+		MicroConfigurer: func(db *gorm.DB) microrpc.MicroModuleConfigurer {
+			return microrpc.MicroModuleConfigurer{ServiceHandlerRegister: func(s server.Server) {
+				s.Handle(s.NewHandler(&Greeter{db: db}))
+			}}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.State() != health.StateReady {
+		t.Fatalf("expect ready, but got %s", app.State())
+	}
+	if err := app.DB.AutoMigrate(&user{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DB.Create(&user{Name: "u1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := app.Http.Get(app.URL("/health/ready"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Status string
+	}
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || report.Status != health.STATUS_UP {
+		t.Fatalf("expect ready 200 UP, but got %d %s", resp.StatusCode, report.Status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := app.Rpc.NewRequest("infratest", "Greeter.Hello", &HelloRequest{Name: "infra"}, client.WithContentType("application/json"))
+	rsp := &HelloResponse{}
+	if err := app.Rpc.Call(ctx, req, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Greeting != "hello infra" || rsp.Users != 1 {
+		t.Fatalf("unexpected rpc response: %+v", rsp)
+	}
+
+	if err := app.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if app.State() != health.StateStopped {
+		t.Fatalf("expect stopped after cleanup, but got %s", app.State())
+	}
+	if err := app.DB.DB().Ping(); err == nil {
+		t.Fatal("expect db closed after cleanup")
+	}
+	if _, err := app.Http.Get(app.URL("/health/live")); err == nil {
+		t.Fatal("expect http server stopped after cleanup")
+	}
+}
@@ -0,0 +1,104 @@
+package zaplog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"go.uber.org/zap"
+	"strings"
+)
+
+//请求头或micro metadata中的关联信息
+const (
+	HEADER_REQUEST_ID   = "X-Request-Id"
+	HEADER_TRACE_ID     = "X-Trace-Id"
+	HEADER_TRACEPARENT  = "traceparent" //W3C trace context, 没有X-Trace-Id时使用其中的trace id
+	HEADER_USER_ID      = "X-User-Id"
+	HEADER_FROM_SERVICE = "X-From-Service" //调用方的服务名
+)
+
+//日志中的关联字段
+const (
+	FIELD_REQUEST_ID   = "requestId"
+	FIELD_TRACE_ID     = "traceId"
+	FIELD_USER_ID      = "userId"
+	FIELD_PEER_SERVICE = "peerService"
+)
+
+//请求的关联信息, 由gin/micro的中间件从请求中解析
+type Correlation struct {
+	RequestID   string
+	TraceID     string
+	UserID      string
+	PeerService string
+}
+
+func (c Correlation) Fields() []zap.Field {
+	fields := make([]zap.Field, 0, 4)
+	if c.RequestID != "" {
+		fields = append(fields, zap.String(FIELD_REQUEST_ID, c.RequestID))
+	}
+	if c.TraceID != "" {
+		fields = append(fields, zap.String(FIELD_TRACE_ID, c.TraceID))
+	}
+	if c.UserID != "" {
+		fields = append(fields, zap.String(FIELD_USER_ID, c.UserID))
+	}
+	if c.PeerService != "" {
+		fields = append(fields, zap.String(FIELD_PEER_SERVICE, c.PeerService))
+	}
+	return fields
+}
+
+type loggerKey struct{}
+
+type correlationKey struct{}
+
+//context中的logger, 不存在时返回全局logger
+func FromContext(ctx context.Context) *zap.Logger {
+	return FromContextOr(ctx, zap.L())
+}
+
+//context中的logger, 不存在时返回logger
+func FromContextOr(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+			return l
+		}
+	}
+	return logger
+}
+
+//在context中的logger上追加字段, 之后通过FromContext获取的logger都会带上这些字段
+func WithContext(ctx context.Context, fields ...zap.Field) context.Context {
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(fields...))
+}
+
+//将带有关联字段的logger和关联信息放入context, 关联信息用于调用下游服务时传递
+func WithCorrelation(ctx context.Context, logger *zap.Logger, correlation Correlation) context.Context {
+	ctx = context.WithValue(ctx, correlationKey{}, correlation)
+	return context.WithValue(ctx, loggerKey{}, logger.With(correlation.Fields()...))
+}
+
+func CorrelationFrom(ctx context.Context) (Correlation, bool) {
+	correlation, ok := ctx.Value(correlationKey{}).(Correlation)
+	return correlation, ok
+}
+
+//从W3C traceparent(version-traceid-parentid-flags)中解析trace id
+func ParseTraceparent(traceparent string) string {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
+
+//随机生成32位十六进制的id, 用于请求没有携带request id时
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,414 @@
+package zaplog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	ENCODER_JSON    = "json"
+	ENCODER_CONSOLE = "console"
+	ENCODER_LOGFMT  = "logfmt"
+
+	TIME_RFC3339      = "rfc3339"
+	TIME_RFC3339_NANO = "rfc3339nano"
+	TIME_ISO8601      = "iso8601"
+	TIME_EPOCH        = "epoch" //秒, 浮点数
+	TIME_EPOCH_MILLIS = "epochmillis"
+	TIME_EPOCH_NANOS  = "epochnanos"
+
+	CALLER_FUNCTION = "function" //pkg/file.go:line:pkg.Func
+	CALLER_SHORT    = "short"    //pkg/file.go:line
+	CALLER_FULL     = "full"     //完整路径
+
+	KEY_OMIT = "-" //不输出该字段
+)
+
+//日志字段名, 为空时使用encoder的默认值, "-"表示不输出
+type EncoderKeys struct {
+	Time       string
+	Level      string
+	Name       string
+	Caller     string
+	Message    string
+	Stacktrace string
+}
+
+type EncoderConstructor func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error)
+
+var (
+	encoderMu sync.RWMutex
+	encoders  = map[string]EncoderConstructor{
+		ENCODER_JSON: func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewJSONEncoder(cfg), nil
+		},
+		ENCODER_CONSOLE: func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewConsoleEncoder(cfg), nil
+		},
+		ENCODER_LOGFMT: func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return newLogfmtEncoder(cfg), nil
+		},
+	}
+)
+
+//注册自定义encoder, 在zap-logs的encoder中按名称引用
+func RegisterEncoder(name string, constructor EncoderConstructor) {
+	encoderMu.Lock()
+	defer encoderMu.Unlock()
+	encoders[strings.ToLower(name)] = constructor
+}
+
+func hasEncoder(name string) bool {
+	encoderMu.RLock()
+	defer encoderMu.RUnlock()
+	_, ok := encoders[strings.ToLower(name)]
+	return ok
+}
+
+//stdout/stderr默认为console, 文件默认为json, 与原有格式保持一致
+func isConsole(option Option) bool {
+	return option.FilePath == "stdout" || option.FilePath == "stderr"
+}
+
+func newEncoder(option Option) (zapcore.Encoder, error) {
+	name := strings.ToLower(option.Encoder)
+	if name == "" {
+		name = ENCODER_JSON
+		if isConsole(option) {
+			name = ENCODER_CONSOLE
+		}
+	}
+	encoderMu.RLock()
+	constructor, ok := encoders[name]
+	encoderMu.RUnlock()
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("log encoder[%s] is not registered", option.Encoder))
+	}
+	cfg, err := encoderConfig(option)
+	if err != nil {
+		return nil, err
+	}
+	return constructor(cfg)
+}
+
+func encoderConfig(option Option) (zapcore.EncoderConfig, error) {
+	var cfg zapcore.EncoderConfig
+	if isConsole(option) {
+		cfg = zap.NewDevelopmentEncoderConfig()
+	} else {
+		cfg = zap.NewProductionEncoderConfig()
+		//添加下划线前缀, 避免与biz fields重复
+		cfg.TimeKey = "_time"
+		cfg.LevelKey = "_level"
+		cfg.NameKey = "_logger"
+		cfg.CallerKey = "_caller"
+		cfg.MessageKey = "_msg"
+		cfg.StacktraceKey = "_stacktrace"
+		cfg.EncodeTime = layoutTimeEncoder("2006-01-02 15:04:05.000", false)
+	}
+	if option.Keys != nil {
+		overrideKey(&cfg.TimeKey, option.Keys.Time)
+		overrideKey(&cfg.LevelKey, option.Keys.Level)
+		overrideKey(&cfg.NameKey, option.Keys.Name)
+		overrideKey(&cfg.CallerKey, option.Keys.Caller)
+		overrideKey(&cfg.MessageKey, option.Keys.Message)
+		overrideKey(&cfg.StacktraceKey, option.Keys.Stacktrace)
+	}
+	if option.TimeFormat != "" || option.UTC {
+		encodeTime, err := timeEncoder(option.TimeFormat, option.UTC, isConsole(option))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.EncodeTime = encodeTime
+	}
+	switch strings.ToLower(option.Caller) {
+	case "", CALLER_FUNCTION:
+		cfg.EncodeCaller = callerEncoder
+	case CALLER_SHORT:
+		cfg.EncodeCaller = zapcore.ShortCallerEncoder
+	case CALLER_FULL:
+		cfg.EncodeCaller = zapcore.FullCallerEncoder
+	}
+	return cfg, nil
+}
+
+func overrideKey(key *string, value string) {
+	switch value {
+	case "":
+	case KEY_OMIT:
+		*key = ""
+	default:
+		*key = value
+	}
+}
+
+//format为空时保持encoder默认的格式, 只转换为UTC
+func timeEncoder(format string, utc bool, console bool) (zapcore.TimeEncoder, error) {
+	switch strings.ToLower(format) {
+	case "":
+		if console {
+			return layoutTimeEncoder("2006-01-02T15:04:05.000Z0700", utc), nil
+		}
+		return layoutTimeEncoder("2006-01-02 15:04:05.000", utc), nil
+	case TIME_RFC3339:
+		return layoutTimeEncoder(time.RFC3339, utc), nil
+	case TIME_RFC3339_NANO:
+		return layoutTimeEncoder(time.RFC3339Nano, utc), nil
+	case TIME_ISO8601:
+		return layoutTimeEncoder("2006-01-02T15:04:05.000Z0700", utc), nil
+	case TIME_EPOCH:
+		return zapcore.EpochTimeEncoder, nil
+	case TIME_EPOCH_MILLIS:
+		return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendInt64(t.UnixNano() / int64(time.Millisecond))
+		}, nil
+	case TIME_EPOCH_NANOS:
+		return zapcore.EpochNanosTimeEncoder, nil
+	}
+	if !strings.Contains(format, "2006") && !strings.Contains(format, "15") {
+		return nil, errors.New(fmt.Sprintf("log time format[%s] is invalid", format))
+	}
+	return layoutTimeEncoder(format, utc), nil
+}
+
+func layoutTimeEncoder(layout string, utc bool) zapcore.TimeEncoder {
+	return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		if utc {
+			t = t.UTC()
+		}
+		enc.AppendString(t.Format(layout))
+	}
+}
+
+func callerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+	funcName := runtime.FuncForPC(caller.PC).Name()
+	slashLastIdx := strings.LastIndex(funcName, "/")
+	enc.AppendString(strings.Join([]string{caller.TrimmedPath(), funcName[slashLastIdx+1:]}, ":"))
+}
+
+//key=value格式, 字段按写入顺序输出, 嵌套的对象与数组输出为json
+type logfmtEncoder struct {
+	cfg       zapcore.EncoderConfig
+	fields    []logfmtField
+	namespace string
+}
+
+type logfmtField struct {
+	key   string
+	value interface{}
+}
+
+func newLogfmtEncoder(cfg zapcore.EncoderConfig) *logfmtEncoder {
+	return &logfmtEncoder{cfg: cfg}
+}
+
+func (e *logfmtEncoder) add(key string, value interface{}) {
+	e.fields = append(e.fields, logfmtField{key: e.namespace + key, value: value})
+}
+
+func (e *logfmtEncoder) AddArray(key string, v zapcore.ArrayMarshaler) error {
+	m := zapcore.NewMapObjectEncoder()
+	err := m.AddArray(key, v)
+	e.add(key, m.Fields[key])
+	return err
+}
+
+func (e *logfmtEncoder) AddObject(key string, v zapcore.ObjectMarshaler) error {
+	m := zapcore.NewMapObjectEncoder()
+	err := v.MarshalLogObject(m)
+	e.add(key, m.Fields)
+	return err
+}
+
+func (e *logfmtEncoder) AddBinary(key string, v []byte)               { e.add(key, v) }
+func (e *logfmtEncoder) AddByteString(key string, v []byte)           { e.add(key, string(v)) }
+func (e *logfmtEncoder) AddBool(key string, v bool)                   { e.add(key, v) }
+func (e *logfmtEncoder) AddComplex128(key string, v complex128)       { e.add(key, v) }
+func (e *logfmtEncoder) AddComplex64(key string, v complex64)         { e.add(key, v) }
+func (e *logfmtEncoder) AddFloat64(key string, v float64)             { e.add(key, v) }
+func (e *logfmtEncoder) AddFloat32(key string, v float32)             { e.add(key, v) }
+func (e *logfmtEncoder) AddInt(key string, v int)                     { e.add(key, v) }
+func (e *logfmtEncoder) AddInt64(key string, v int64)                 { e.add(key, v) }
+func (e *logfmtEncoder) AddInt32(key string, v int32)                 { e.add(key, v) }
+func (e *logfmtEncoder) AddInt16(key string, v int16)                 { e.add(key, v) }
+func (e *logfmtEncoder) AddInt8(key string, v int8)                   { e.add(key, v) }
+func (e *logfmtEncoder) AddString(key string, v string)               { e.add(key, v) }
+func (e *logfmtEncoder) AddUint(key string, v uint)                   { e.add(key, v) }
+func (e *logfmtEncoder) AddUint64(key string, v uint64)               { e.add(key, v) }
+func (e *logfmtEncoder) AddUint32(key string, v uint32)               { e.add(key, v) }
+func (e *logfmtEncoder) AddUint16(key string, v uint16)               { e.add(key, v) }
+func (e *logfmtEncoder) AddUint8(key string, v uint8)                 { e.add(key, v) }
+func (e *logfmtEncoder) AddUintptr(key string, v uintptr)             { e.add(key, v) }
+func (e *logfmtEncoder) AddReflected(key string, v interface{}) error { e.add(key, v); return nil }
+func (e *logfmtEncoder) OpenNamespace(key string)                     { e.namespace += key + "." }
+
+func (e *logfmtEncoder) AddDuration(key string, v time.Duration) {
+	e.add(key, e.primitive(func(enc zapcore.PrimitiveArrayEncoder) {
+		if e.cfg.EncodeDuration == nil {
+			enc.AppendString(v.String())
+			return
+		}
+		e.cfg.EncodeDuration(v, enc)
+	}, v.String()))
+}
+
+func (e *logfmtEncoder) AddTime(key string, v time.Time) {
+	e.add(key, e.primitive(func(enc zapcore.PrimitiveArrayEncoder) {
+		e.cfg.EncodeTime(v, enc)
+	}, v.Format(time.RFC3339Nano)))
+}
+
+//通过EncoderConfig中的函数编码时间、级别等, 未配置时使用fallback
+func (e *logfmtEncoder) primitive(encode func(enc zapcore.PrimitiveArrayEncoder), fallback interface{}) interface{} {
+	m := zapcore.NewMapObjectEncoder()
+	m.AddArray("v", zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+		encode(enc)
+		return nil
+	}))
+	if values, ok := m.Fields["v"].([]interface{}); ok && len(values) > 0 {
+		return values[0]
+	}
+	return fallback
+}
+
+func (e *logfmtEncoder) Clone() zapcore.Encoder {
+	clone := &logfmtEncoder{cfg: e.cfg, namespace: e.namespace}
+	clone.fields = append(make([]logfmtField, 0, len(e.fields)), e.fields...)
+	return clone
+}
+
+func (e *logfmtEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	line := &logfmtEncoder{cfg: e.cfg}
+	if e.cfg.TimeKey != "" && e.cfg.EncodeTime != nil {
+		line.add(e.cfg.TimeKey, line.primitive(func(enc zapcore.PrimitiveArrayEncoder) {
+			e.cfg.EncodeTime(entry.Time, enc)
+		}, entry.Time.Format(time.RFC3339Nano)))
+	}
+	if e.cfg.LevelKey != "" {
+		line.add(e.cfg.LevelKey, line.primitive(func(enc zapcore.PrimitiveArrayEncoder) {
+			if e.cfg.EncodeLevel == nil {
+				enc.AppendString(entry.Level.String())
+				return
+			}
+			e.cfg.EncodeLevel(entry.Level, enc)
+		}, entry.Level.String()))
+	}
+	if e.cfg.NameKey != "" && entry.LoggerName != "" {
+		line.add(e.cfg.NameKey, entry.LoggerName)
+	}
+	if e.cfg.CallerKey != "" && entry.Caller.Defined {
+		line.add(e.cfg.CallerKey, line.primitive(func(enc zapcore.PrimitiveArrayEncoder) {
+			if e.cfg.EncodeCaller == nil {
+				enc.AppendString(entry.Caller.TrimmedPath())
+				return
+			}
+			e.cfg.EncodeCaller(entry.Caller, enc)
+		}, entry.Caller.TrimmedPath()))
+	}
+	if e.cfg.MessageKey != "" {
+		line.add(e.cfg.MessageKey, entry.Message)
+	}
+	line.fields = append(line.fields, e.fields...)
+	line.namespace = e.namespace
+	for _, field := range fields {
+		field.AddTo(line)
+	}
+	if e.cfg.StacktraceKey != "" && entry.Stack != "" {
+		line.namespace = ""
+		line.add(e.cfg.StacktraceKey, entry.Stack)
+	}
+
+	buf := bufferPool.Get()
+	for i, field := range line.fields {
+		if i > 0 {
+			buf.AppendByte(' ')
+		}
+		buf.AppendString(logfmtKey(field.key))
+		buf.AppendByte('=')
+		buf.AppendString(logfmtValue(field.value))
+	}
+	lineEnding := e.cfg.LineEnding
+	if lineEnding == "" {
+		lineEnding = zapcore.DefaultLineEnding
+	}
+	buf.AppendString(lineEnding)
+	return buf, nil
+}
+
+var bufferPool = buffer.NewPool()
+
+//key中的空格、等号与引号替换为下划线
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func logfmtValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return quote(v)
+	case []byte:
+		return quote(string(v))
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return formatFloat(v, 64)
+	case float32:
+		return formatFloat(float64(v), 32)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr:
+		return fmt.Sprint(v)
+	case error:
+		return quote(v.Error())
+	case fmt.Stringer:
+		return quote(v.String())
+	case complex64, complex128:
+		return quote(fmt.Sprint(v))
+	}
+	out, err := json.Marshal(value)
+	if err != nil {
+		return quote(fmt.Sprintf("%+v", value))
+	}
+	return quote(string(out))
+}
+
+func formatFloat(f float64, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return `"NaN"`
+	case math.IsInf(f, 1):
+		return `"+Inf"`
+	case math.IsInf(f, -1):
+		return `"-Inf"`
+	}
+	return strconv.FormatFloat(f, 'f', -1, bitSize)
+}
+
+//包含空格、等号、引号或控制字符时加引号
+func quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
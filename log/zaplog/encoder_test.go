@@ -0,0 +1,211 @@
+package zaplog
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.FixedZone("CST", 8*3600))
+
+func encodeLogfmt(t *testing.T, option Option, entry zapcore.Entry, fields ...zapcore.Field) string {
+	option.Encoder = ENCODER_LOGFMT
+	encoder, err := newEncoder(option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Free()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+//只输出message与字段
+func encodeFields(t *testing.T, fields ...zapcore.Field) string {
+	keys := &EncoderKeys{Time: KEY_OMIT, Level: KEY_OMIT, Name: KEY_OMIT, Caller: KEY_OMIT, Stacktrace: KEY_OMIT}
+	line := encodeLogfmt(t, Option{FilePath: "app.log", Keys: keys}, zapcore.Entry{Message: "m"}, fields...)
+	return strings.TrimPrefix(line, "_msg=m ")
+}
+
+func TestLogfmtValues(t *testing.T) {
+	cases := []struct {
+		field    zapcore.Field
+		expected string
+	}{
+		{zap.String("k", "plain"), `k=plain`},
+		{zap.String("k", "with space"), `k="with space"`},
+		{zap.String("k", `say "hi"`), `k="say \"hi\""`},
+		{zap.String("k", "a=b"), `k="a=b"`},
+		{zap.String("k", "line1\nline2"), `k="line1\nline2"`},
+		{zap.String("k", "tab\there"), `k="tab\there"`},
+		{zap.String("k", ""), `k=""`},
+		{zap.String("k", "中文"), `k=中文`},
+		{zap.ByteString("k", []byte("a b")), `k="a b"`},
+		{zap.Binary("k", []byte("ab")), `k=ab`},
+		{zap.Bool("k", true), `k=true`},
+		{zap.Int("k", -3), `k=-3`},
+		{zap.Uint64("k", 18446744073709551615), `k=18446744073709551615`},
+		{zap.Float64("k", 1.5), `k=1.5`},
+		{zap.Float32("k", 0.1), `k=0.1`},
+		{zap.Complex128("k", complex(1, 2)), `k=(1+2i)`},
+		{zap.Duration("k", 1500*time.Millisecond), `k=1.5`},
+		{zap.Error(errors.New("bad thing")), `error="bad thing"`},
+		{zap.Stringer("k", time.Second), `k=1s`},
+		{zap.Reflect("k", nil), `k=null`},
+		{zap.Reflect("k", map[string]int{"a": 1}), `k="{\"a\":1}"`},
+		{zap.String("bad key", "v"), `bad_key=v`},
+		{zap.String(`a="b"`, "v"), `a__b_=v`},
+	}
+	for _, c := range cases {
+		if actual := encodeFields(t, c.field); actual != c.expected {
+			t.Errorf("expect %s, but got %s", c.expected, actual)
+		}
+	}
+}
+
+type testObject struct {
+	name  string
+	tags  []string
+	inner *testObject
+}
+
+func (o testObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", o.name)
+	if err := enc.AddArray("tags", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, tag := range o.tags {
+			arr.AppendString(tag)
+		}
+		return nil
+	})); err != nil {
+		return err
+	}
+	if o.inner != nil {
+		return enc.AddObject("inner", o.inner)
+	}
+	return nil
+}
+
+func TestLogfmtNested(t *testing.T) {
+	cases := []struct {
+		fields   []zapcore.Field
+		expected string
+	}{
+		{[]zapcore.Field{zap.Ints("k", []int{1, 2})}, `k=[1,2]`},
+		{[]zapcore.Field{zap.Ints("k", nil)}, `k=[]`},
+		{[]zapcore.Field{zap.Strings("k", []string{"a", "b c"})}, `k="[\"a\",\"b c\"]"`},
+		{[]zapcore.Field{zap.Object("k", testObject{name: "n", tags: []string{"t"}})}, `k="{\"name\":\"n\",\"tags\":[\"t\"]}"`},
+		{[]zapcore.Field{zap.Object("k", testObject{name: "a", inner: &testObject{name: "b"}})},
+			`k="{\"inner\":{\"name\":\"b\",\"tags\":[]},\"name\":\"a\",\"tags\":[]}"`},
+		{[]zapcore.Field{zap.Namespace("req"), zap.String("id", "1"), zap.Int("size", 2)}, `req.id=1 req.size=2`},
+	}
+	for _, c := range cases {
+		if actual := encodeFields(t, c.fields...); actual != c.expected {
+			t.Errorf("expect %s, but got %s", c.expected, actual)
+		}
+	}
+}
+
+func TestLogfmtEntry(t *testing.T) {
+	entry := zapcore.Entry{
+		Level:      zapcore.WarnLevel,
+		Time:       testTime,
+		LoggerName: "svc",
+		Message:    "hello world",
+		Caller:     zapcore.NewEntryCaller(0, "/go/src/pkg/file.go", 12, true),
+		Stack:      "goroutine 1\nmain.main()",
+	}
+	encoder, err := newEncoder(Option{FilePath: "app.log", Encoder: ENCODER_LOGFMT, Caller: CALLER_SHORT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//With添加的字段在entry字段之前, Clone后互不影响
+	with := encoder.Clone()
+	zap.String("app", "demo").AddTo(with)
+	buf, err := with.EncodeEntry(entry, []zapcore.Field{zap.Int("n", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `_time="2020-01-02 03:04:05.006" _level=warn _logger=svc _caller=pkg/file.go:12 _msg="hello world" app=demo n=1 _stacktrace="goroutine 1\nmain.main()"` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("expect %s, but got %s", expected, buf.String())
+	}
+	buf, err = encoder.EncodeEntry(zapcore.Entry{Time: testTime, Message: "m"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "app=demo") {
+		t.Fatalf("expect clone not affect the origin encoder, but got %s", buf.String())
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	cases := []struct {
+		format   string
+		utc      bool
+		console  bool
+		expected string
+	}{
+		{"", false, false, `2020-01-02 03:04:05.006`},
+		{"", true, false, `2020-01-01 19:04:05.006`},
+		{"", false, true, `2020-01-02T03:04:05.006+0800`},
+		{TIME_RFC3339, false, false, `2020-01-02T03:04:05+08:00`},
+		{TIME_RFC3339, true, false, `2020-01-01T19:04:05Z`},
+		{"RFC3339Nano", false, false, `2020-01-02T03:04:05.006+08:00`},
+		{TIME_ISO8601, true, false, `2020-01-01T19:04:05.006Z`},
+		{TIME_EPOCH, false, false, `1577905445.006`},
+		{TIME_EPOCH_MILLIS, false, false, `1577905445006`},
+		{TIME_EPOCH_NANOS, false, false, `1577905445006000000`},
+		{"2006/01/02 15:04", false, false, `2020/01/02 03:04`},
+	}
+	for _, c := range cases {
+		encodeTime, err := timeEncoder(c.format, c.utc, c.console)
+		if err != nil {
+			t.Fatalf("format[%s]: %v", c.format, err)
+		}
+		encoder := &logfmtEncoder{cfg: zapcore.EncoderConfig{EncodeTime: encodeTime}}
+		encoder.AddTime("t", testTime)
+		if actual := logfmtValue(encoder.fields[0].value); actual != c.expected && actual != `"`+c.expected+`"` {
+			t.Errorf("format[%s] utc[%v]: expect %s, but got %s", c.format, c.utc, c.expected, actual)
+		}
+	}
+	if _, err := timeEncoder("yyyy-MM-dd", false, false); err == nil {
+		t.Fatal("expect error for invalid time format")
+	}
+}
+
+func TestEncoderKeys(t *testing.T) {
+	entry := zapcore.Entry{Level: zapcore.InfoLevel, Time: testTime, LoggerName: "svc", Message: "m",
+		Caller: zapcore.NewEntryCaller(0, "/go/src/pkg/file.go", 12, true)}
+	cases := []struct {
+		option   Option
+		expected string
+	}{
+		{Option{FilePath: "app.log", Keys: &EncoderKeys{Time: "ts", Level: "lvl", Name: "logger", Caller: "src", Message: "msg"}, Caller: CALLER_SHORT},
+			`ts="2020-01-02 03:04:05.006" lvl=info logger=svc src=pkg/file.go:12 msg=m`},
+		{Option{FilePath: "app.log", Keys: &EncoderKeys{Time: KEY_OMIT, Caller: KEY_OMIT, Name: KEY_OMIT}},
+			`_level=info _msg=m`},
+		{Option{FilePath: "app.log", Keys: &EncoderKeys{Level: "severity"}, TimeFormat: TIME_EPOCH_MILLIS, Caller: CALLER_SHORT},
+			`_time=1577905445006 severity=info _logger=svc _caller=pkg/file.go:12 _msg=m`},
+		{Option{FilePath: "stdout", Keys: &EncoderKeys{Time: KEY_OMIT, Caller: KEY_OMIT}, UTC: true},
+			`L=INFO N=svc M=m`},
+	}
+	for _, c := range cases {
+		if actual := encodeLogfmt(t, c.option, entry); actual != c.expected {
+			t.Errorf("expect %s, but got %s", c.expected, actual)
+		}
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	if _, err := newEncoder(Option{FilePath: "app.log", Encoder: "unknown"}); err == nil {
+		t.Fatal("expect error for unregistered encoder")
+	}
+	if _, err := newEncoder(Option{FilePath: "app.log", TimeFormat: "bad"}); err == nil {
+		t.Fatal("expect error for invalid time format")
+	}
+}
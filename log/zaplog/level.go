@@ -0,0 +1,216 @@
+package zaplog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//各sink的日志级别, New时保留, 可在运行时按sink名称调整
+type Levels struct {
+	mu     sync.RWMutex
+	sinks  []string
+	levels map[string]*sinkLevel
+}
+
+type sinkLevel struct {
+	level      zap.AtomicLevel
+	configured zapcore.Level //配置中的级别, 临时调整到期后恢复
+	timer      *time.Timer
+	revertAt   time.Time
+}
+
+//sink当前的级别, RevertAt为临时调整恢复到配置级别的时间
+type SinkLevel struct {
+	Name       string     `json:"name"`
+	Level      string     `json:"level"`
+	Configured string     `json:"configured"`
+	RevertAt   *time.Time `json:"revertAt,omitempty"`
+}
+
+func newLevels() *Levels {
+	return &Levels{levels: make(map[string]*sinkLevel)}
+}
+
+func (l *Levels) add(sink string, level zap.AtomicLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.levels[sink]; !ok {
+		l.sinks = append(l.sinks, sink)
+	}
+	l.levels[sink] = &sinkLevel{level: level, configured: level.Level()}
+}
+
+func (l *Levels) Get() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	levels := make(map[string]string, len(l.levels))
+	for sink, level := range l.levels {
+		levels[sink] = level.level.Level().String()
+	}
+	return levels
+}
+
+//按创建顺序返回各sink的级别
+func (l *Levels) Sinks() []SinkLevel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	sinks := make([]SinkLevel, 0, len(l.sinks))
+	for _, name := range l.sinks {
+		level := l.levels[name]
+		sink := SinkLevel{Name: name, Level: level.level.Level().String(), Configured: level.configured.String()}
+		if level.timer != nil {
+			revertAt := level.revertAt
+			sink.RevertAt = &revertAt
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
+
+func (l *Levels) SetAll(level zapcore.Level) {
+	l.Set("", level, 0)
+}
+
+//调整sink的级别, sink为空时调整所有sink, ttl大于0时到期后恢复为配置中的级别
+func (l *Levels) Set(sink string, level zapcore.Level, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sinks := l.sinks
+	if sink != "" {
+		if _, ok := l.levels[sink]; !ok {
+			return errors.New(fmt.Sprintf("log sink[%s] is not found", sink))
+		}
+		sinks = []string{sink}
+	}
+	for _, name := range sinks {
+		s := l.levels[name]
+		if s.timer != nil {
+			s.timer.Stop()
+			s.timer = nil
+		}
+		s.level.SetLevel(level)
+		if ttl > 0 {
+			s.revertAt = time.Now().Add(ttl)
+			var timer *time.Timer
+			timer = time.AfterFunc(ttl, func() {
+				l.revert(s, timer)
+			})
+			s.timer = timer
+		}
+	}
+	return nil
+}
+
+//timer已被新的调整替换时不恢复
+func (l *Levels) revert(s *sinkLevel, timer *time.Timer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s.timer != timer {
+		return
+	}
+	s.timer = nil
+	s.level.SetLevel(s.configured)
+}
+
+//配置中的级别变更, 存在临时调整时在到期后生效
+func (l *Levels) configure(sink string, level zapcore.Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.levels[sink]
+	if !ok {
+		return false
+	}
+	s.configured = level
+	if s.timer == nil {
+		s.level.SetLevel(level)
+	}
+	return true
+}
+
+//zap-logs变更时按sink名称更新级别, 新增/删除sink及其他选项需要重启生效
+func watchLevels(c config.Config, levels *Levels, logger *zap.Logger) func() {
+	return c.Watch("zap-logs", func(old, new interface{}) {
+		o, err := NewOptions(c)
+		if err != nil {
+			logger.Error("failed to reload log levels, keep current levels", zap.Error(err))
+			return
+		}
+		for _, option := range o.Options {
+			if !levels.configure(option.Name, option.Lv) {
+				logger.Warn(fmt.Sprintf("log sink[%s] is added, restart to take effect", option.Name))
+				continue
+			}
+			logger.Info(fmt.Sprintf("log sink[%s] level is configured to %s", option.Name, option.Lv))
+		}
+	})
+}
+
+//GET: 查询各sink的级别
+//PUT: {"level":"debug", "sink":"stdout", "ttl":"10m"} 调整级别, sink为空时调整所有sink, ttl到期后恢复为配置中的级别
+func (l *Levels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req struct {
+			Level string `json:"level"`
+			Sink  string `json:"sink"`
+			TTL   string `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		var lv zapcore.Level
+		if err := lv.UnmarshalText([]byte(req.Level)); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("log level[%s] is invalid", req.Level)})
+			return
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl < 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("ttl[%s] is invalid", req.TTL)})
+				return
+			}
+		}
+		if err := l.Set(req.Sink, lv, ttl); err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not support"})
+		return
+	}
+	writeJSON(w, http.StatusOK, l.Sinks())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+var (
+	globalMu     sync.RWMutex
+	globalLevels = newLevels()
+)
+
+//最近一次New创建的logger的各sink级别, 与zap.ReplaceGlobals保持一致
+func GlobalLevels() *Levels {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return globalLevels
+}
+
+func replaceGlobalLevels(levels *Levels) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	globalLevels = levels
+}
@@ -0,0 +1,371 @@
+package zaplog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	CONF_MASK = "zap-mask"
+	MASK_FULL = "******" //完全遮盖时的输出, 不暴露原值长度
+)
+
+//日志脱敏配置, 对所有sink生效
+type MaskOptions struct {
+	Disabled bool
+	Rules    []MaskRule
+}
+
+//fields与pattern至少配置一个
+//fields匹配字段名(包括zap.Any中map/struct的key), 匹配的值整体遮盖
+//pattern匹配message及字符串值(包括error、zap.Any中的字符串、gorm的SQL参数), 只遮盖匹配的部分, 多个规则按顺序执行
+//keepFirst/keepLast保留头尾的字符, 例如手机号keepFirst: 3, keepLast: 4输出138****1234, 都为0时输出******
+type MaskRule struct {
+	Name      string
+	Fields    []string //支持*和?通配, 不区分大小写
+	Pattern   string
+	KeepFirst int    `min:"0"`
+	KeepLast  int    `min:"0"`
+	Mask      string `default:"*"`
+	pattern   *regexp.Regexp
+}
+
+func init() {
+	config.RegisterSchema(CONF_MASK, MaskOptions{})
+}
+
+func newMaskOptions(c config.Config) (*MaskOptions, error) {
+	o := &MaskOptions{}
+	if err := config.Bind(c, CONF_MASK, o); err != nil {
+		return nil, err
+	}
+	for idx, _ := range o.Rules {
+		rule := &o.Rules[idx]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("%s[%d]", CONF_MASK, idx)
+		}
+		if len(rule.Fields) == 0 && rule.Pattern == "" {
+			return nil, errors.New(fmt.Sprintf("log mask rule[%s] must have fields or pattern", rule.Name))
+		}
+		for i, field := range rule.Fields {
+			rule.Fields[i] = strings.ToLower(field)
+			if _, err := path.Match(rule.Fields[i], ""); err != nil {
+				return nil, errors.New(fmt.Sprintf("log mask rule[%s] field pattern[%s] is invalid", rule.Name, field))
+			}
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("log mask rule[%s] pattern[%s] is invalid: %v", rule.Name, rule.Pattern, err))
+			}
+			rule.pattern = pattern
+		}
+	}
+	return o, nil
+}
+
+type masker struct {
+	rules    []MaskRule
+	fields   bool     //存在按字段名的规则
+	patterns bool     //存在按值的规则
+	shapes   sync.Map //reflect.Type -> shape
+}
+
+func newMasker(o *MaskOptions) *masker {
+	if o == nil || o.Disabled || len(o.Rules) == 0 {
+		return nil
+	}
+	m := &masker{rules: o.Rules}
+	for _, rule := range o.Rules {
+		m.fields = m.fields || len(rule.Fields) > 0
+		m.patterns = m.patterns || rule.pattern != nil
+	}
+	return m
+}
+
+//匹配字段名的规则, 没有时返回nil
+func (m *masker) fieldRule(key string) *MaskRule {
+	key = strings.ToLower(key)
+	for idx := range m.rules {
+		for _, field := range m.rules[idx].Fields {
+			if ok, _ := path.Match(field, key); ok {
+				return &m.rules[idx]
+			}
+		}
+	}
+	return nil
+}
+
+func (m *masker) maskString(s string) string {
+	for idx := range m.rules {
+		rule := &m.rules[idx]
+		if rule.pattern != nil {
+			s = rule.pattern.ReplaceAllStringFunc(s, rule.mask)
+		}
+	}
+	return s
+}
+
+func (r *MaskRule) mask(s string) string {
+	if r.KeepFirst == 0 && r.KeepLast == 0 {
+		return MASK_FULL
+	}
+	runes := []rune(s)
+	if len(runes) <= r.KeepFirst+r.KeepLast {
+		return MASK_FULL
+	}
+	return string(runes[:r.KeepFirst]) + strings.Repeat(r.Mask, len(runes)-r.KeepFirst-r.KeepLast) + string(runes[len(runes)-r.KeepLast:])
+}
+
+func (m *masker) maskFields(fields []zapcore.Field) []zapcore.Field {
+	var masked []zapcore.Field
+	for i, field := range fields {
+		if f, ok := m.maskField(field); ok {
+			if masked == nil {
+				masked = make([]zapcore.Field, len(fields))
+				copy(masked, fields)
+			}
+			masked[i] = f
+		}
+	}
+	if masked == nil {
+		return fields
+	}
+	return masked
+}
+
+//返回脱敏后的字段, 没有变化时返回false
+func (m *masker) maskField(field zapcore.Field) (zapcore.Field, bool) {
+	if rule := m.fieldRule(field.Key); rule != nil {
+		value := fieldValue(field)
+		switch v := value.(type) {
+		case map[string]interface{}, []interface{}, nil:
+			return zap.String(field.Key, MASK_FULL), true
+		default:
+			return zap.String(field.Key, rule.mask(fmt.Sprint(v))), true
+		}
+	}
+	switch field.Type {
+	case zapcore.StringType, zapcore.ByteStringType, zapcore.StringerType, zapcore.ErrorType:
+		value, ok := fieldValue(field).(string)
+		if !ok {
+			return field, false
+		}
+		if masked := m.maskString(value); masked != value {
+			return zap.String(field.Key, masked), true
+		}
+	case zapcore.ReflectType, zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType:
+		if field.Type == zapcore.ReflectType && !m.applies(field.Interface) {
+			return field, false
+		}
+		value := fieldValue(field)
+		if field.Type == zapcore.ReflectType {
+			//统一为map/slice/基本类型, 以便按key与字符串值脱敏
+			b, err := json.Marshal(value)
+			if err != nil || json.Unmarshal(b, &value) != nil {
+				return field, false
+			}
+		}
+		if masked, changed := m.maskValue(value); changed {
+			return zap.Any(field.Key, masked), true
+		}
+	}
+	return field, false
+}
+
+func (m *masker) maskValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		masked := m.maskString(v)
+		return masked, masked != v
+	case map[string]interface{}:
+		changed := false
+		for key, item := range v {
+			if rule := m.fieldRule(key); rule != nil {
+				switch item.(type) {
+				case map[string]interface{}, []interface{}, nil:
+					v[key] = MASK_FULL
+				default:
+					v[key] = rule.mask(fmt.Sprint(item))
+				}
+				changed = true
+				continue
+			}
+			if masked, ok := m.maskValue(item); ok {
+				v[key] = masked
+				changed = true
+			}
+		}
+		return v, changed
+	case []interface{}:
+		changed := false
+		for i, item := range v {
+			if masked, ok := m.maskValue(item); ok {
+				v[i] = masked
+				changed = true
+			}
+		}
+		return v, changed
+	}
+	return value, false
+}
+
+//值的类型可能包含的内容, 用于跳过不可能被脱敏的zap.Any
+type shape struct {
+	keys    bool //包含字符串key的map或匹配字段名规则的struct字段
+	strings bool //包含字符串
+}
+
+//类型中不包含规则可以匹配的key或字符串时返回false, 避免每条日志都序列化
+func (m *masker) applies(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	t := reflect.TypeOf(value)
+	s, ok := m.shapes.Load(t)
+	if !ok {
+		s, _ = m.shapes.LoadOrStore(t, m.shapeOf(t, make(map[reflect.Type]bool)))
+	}
+	return (m.fields && s.(shape).keys) || (m.patterns && s.(shape).strings)
+}
+
+var jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func (m *masker) shapeOf(t reflect.Type, visiting map[reflect.Type]bool) shape {
+	//自定义序列化与interface无法从类型判断
+	if t.Implements(jsonMarshaler) || reflect.PtrTo(t).Implements(jsonMarshaler) || t.Kind() == reflect.Interface {
+		return shape{keys: true, strings: true}
+	}
+	if visiting[t] {
+		return shape{}
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	switch t.Kind() {
+	case reflect.String:
+		return shape{strings: true}
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		//[]byte序列化为base64字符串
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return shape{strings: true}
+		}
+		return m.shapeOf(t.Elem(), visiting)
+	case reflect.Map:
+		s := m.shapeOf(t.Elem(), visiting)
+		s.keys = s.keys || t.Key().Kind() == reflect.String
+		return s
+	case reflect.Struct:
+		var s shape
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if f.PkgPath != "" || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			//struct的key是固定的, 只有匹配字段名规则时才需要脱敏
+			s.keys = s.keys || m.fieldRule(name) != nil
+			fs := m.shapeOf(f.Type, visiting)
+			s.keys = s.keys || fs.keys
+			s.strings = s.strings || fs.strings
+		}
+		return s
+	}
+	return shape{}
+}
+
+//通过encoder取出字段的值, error为其Error()
+func fieldValue(field zapcore.Field) interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	field.AddTo(enc)
+	return enc.Fields[field.Key]
+}
+
+//包装所有sink的tee, 每条日志只脱敏一次
+//各sink的级别与采样仍由tee中的core在Check时判断, 只有至少一个sink输出的日志才执行脱敏
+type maskCore struct {
+	zapcore.Core
+	masker *masker
+}
+
+func (c *maskCore) With(fields []zapcore.Field) zapcore.Core {
+	return &maskCore{Core: c.Core.With(c.masker.maskFields(fields)), masker: c.masker}
+}
+
+func (c *maskCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	checked := c.Core.Check(entry, nil)
+	if checked == nil {
+		return ce
+	}
+	w := &maskedWrite{masker: c.masker, checked: checked}
+	checked.ErrorOutput = &w.errors
+	return ce.AddCore(entry, w)
+}
+
+func (c *maskCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.masker.maskString(entry.Message)
+	return c.Core.Write(entry, c.masker.maskFields(fields))
+}
+
+//Check时tee中通过级别与采样的sink, 脱敏后写入这些sink
+type maskedWrite struct {
+	masker  *masker
+	checked *zapcore.CheckedEntry
+	errors  writeErrors
+}
+
+func (w *maskedWrite) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (w *maskedWrite) With([]zapcore.Field) zapcore.Core {
+	return w
+}
+
+func (w *maskedWrite) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce
+}
+
+//Check时的entry还没有caller和stack, 使用logger写入时的entry
+func (w *maskedWrite) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	w.checked.Entry = entry
+	w.checked.Entry.Message = w.masker.maskString(entry.Message)
+	w.checked.Write(w.masker.maskFields(fields)...)
+	return w.errors.err
+}
+
+func (w *maskedWrite) Sync() error {
+	return nil
+}
+
+//CheckedEntry.Write把sink的写入错误输出到ErrorOutput, 收集后由外层的CheckedEntry输出到logger的ErrorOutput
+type writeErrors struct {
+	err error
+}
+
+func (e *writeErrors) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	if i := strings.Index(msg, "write error: "); i >= 0 {
+		msg = msg[i+len("write error: "):]
+	}
+	if e.err != nil {
+		msg = e.err.Error() + "; " + msg
+	}
+	e.err = errors.New(msg)
+	return len(p), nil
+}
+
+func (e *writeErrors) Sync() error {
+	return nil
+}
@@ -0,0 +1,143 @@
+package zaplog
+
+import (
+	"bytes"
+	"errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testMasker() *masker {
+	return newMasker(&MaskOptions{Rules: []MaskRule{
+		{Fields: []string{"password", "*token*"}},
+		{Pattern: `\b1[3-9]\d{9}\b`, pattern: regexp.MustCompile(`\b1[3-9]\d{9}\b`), KeepFirst: 3, KeepLast: 4, Mask: "*"},
+	}})
+}
+
+type countStringer struct {
+	calls *int
+}
+
+func (s countStringer) String() string {
+	*s.calls++
+	return "call 13812345678"
+}
+
+func TestMaskOncePerEntry(t *testing.T) {
+	info, infoLogs := observer.New(zapcore.InfoLevel)
+	debug, debugLogs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(&maskCore{Core: zapcore.NewTee(info, debug), masker: testMasker()})
+
+	calls := 0
+	logger.Info("phone 13812345678", zap.String("accessToken", "abc"), zap.Stringer("remark", countStringer{&calls}))
+	if calls != 1 {
+		t.Fatalf("expect masked once for 2 sinks, but String called %d times", calls)
+	}
+	for _, logs := range []*observer.ObservedLogs{infoLogs, debugLogs} {
+		entries := logs.AllUntimed()
+		if len(entries) != 1 {
+			t.Fatalf("expect 1 entry, but got %d", len(entries))
+		}
+		fields := entries[0].ContextMap()
+		if entries[0].Message != "phone 138****5678" || fields["accessToken"] != MASK_FULL || fields["remark"] != "call 138****5678" {
+			t.Fatalf("unexpected masked entry: %s %v", entries[0].Message, fields)
+		}
+	}
+
+	//只输出到debug sink
+	logger.With(zap.String("password", "secret")).Debug("debug")
+	if infoLogs.Len() != 1 || debugLogs.Len() != 2 {
+		t.Fatalf("expect sink levels kept, but got info %d debug %d", infoLogs.Len(), debugLogs.Len())
+	}
+	if fields := debugLogs.AllUntimed()[1].ContextMap(); fields["password"] != MASK_FULL {
+		t.Fatalf("expect With fields masked, but got %v", fields)
+	}
+}
+
+func TestMaskKeepsCallerAndStack(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(&maskCore{Core: zapcore.NewTee(core), masker: testMasker()}, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	logger.Error("phone 13812345678")
+	entries := logs.AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("expect 1 entry, but got %d", len(entries))
+	}
+	entry := entries[0].Entry
+	if entry.Message != "phone 138****5678" {
+		t.Fatalf("expect masked message, but got %s", entry.Message)
+	}
+	if !entry.Caller.Defined || !strings.HasSuffix(entry.Caller.File, "mask_test.go") {
+		t.Fatalf("expect caller kept, but got %+v", entry.Caller)
+	}
+	if !strings.Contains(entry.Stack, "TestMaskKeepsCallerAndStack") {
+		t.Fatalf("expect stack kept, but got %q", entry.Stack)
+	}
+}
+
+type failingCore struct {
+	zapcore.Core
+}
+
+func (c failingCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(entry, c)
+}
+
+func (c failingCore) Write(zapcore.Entry, []zapcore.Field) error {
+	return errors.New("disk full")
+}
+
+func TestMaskReturnsWriteError(t *testing.T) {
+	errorOutput := &bytes.Buffer{}
+	logger := zap.New(&maskCore{Core: zapcore.NewTee(failingCore{zapcore.NewNopCore()}), masker: testMasker()},
+		zap.ErrorOutput(zapcore.AddSync(errorOutput)))
+	logger.Info("phone 13812345678")
+	if !strings.Contains(errorOutput.String(), "write error: disk full") || strings.Count(errorOutput.String(), "\n") != 1 {
+		t.Fatalf("expect write error reported once, but got %q", errorOutput.String())
+	}
+}
+
+func TestMaskKeepsSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	s := newSampler("test", &SamplingOptions{Tick: time.Minute, Initial: 1, maxLevel: zapcore.InfoLevel})
+	logger := zap.New(&maskCore{Core: zapcore.NewTee(&samplerCore{Core: core, sampler: s}), masker: testMasker()})
+	logger.Info("same")
+	logger.Info("same")
+	if logs.Len() != 1 {
+		t.Fatalf("expect sampled entry dropped, but got %d entries", logs.Len())
+	}
+}
+
+func TestMaskReflect(t *testing.T) {
+	m := testMasker()
+	type numbers struct {
+		N []int
+		M map[int]float64
+	}
+	type user struct {
+		Name     string
+		Password string
+		Time     time.Time
+	}
+	if m.applies(numbers{}) || m.applies(42) {
+		t.Fatal("expect types without strings or keys skipped")
+	}
+	if !m.applies(user{}) || !m.applies(map[string]int{}) || !m.applies([]interface{}{}) {
+		t.Fatal("expect types with strings or keys masked")
+	}
+	field, changed := m.maskField(zap.Any("user", user{Name: "13912345678", Password: "p"}))
+	if !changed {
+		t.Fatal("expect user masked")
+	}
+	masked := field.Interface.(map[string]interface{})
+	if masked["Name"] != "139****5678" || masked["Password"] != MASK_FULL {
+		t.Fatalf("unexpected masked user: %v", masked)
+	}
+	if _, changed := m.maskField(zap.Any("numbers", numbers{N: []int{13912345678}})); changed {
+		t.Fatal("expect numbers unchanged")
+	}
+}
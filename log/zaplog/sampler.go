@@ -0,0 +1,157 @@
+package zaplog
+
+import (
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//sink的采样配置, 每个tick内相同级别与message的日志先输出initial条, 之后每thereafter条输出一条
+type SamplingOptions struct {
+	Disabled   bool
+	Tick       time.Duration `default:"1s" min:"1ms"`
+	Initial    int           `default:"100" min:"1"`
+	Thereafter int           `default:"100" min:"0"` //0表示超过initial后全部丢弃
+	MaxLevel   string        `default:"info" oneof:"debug info warn error dpanic panic fatal"` //高于该级别的日志不采样
+	maxLevel   zapcore.Level
+}
+
+//日志被采样丢弃时回调, 在打印日志的goroutine中执行, 需要快速返回
+type SamplerHook func(sink string, entry zapcore.Entry)
+
+var samplerHook atomic.Value //SamplerHook
+
+func SetSamplerHook(hook SamplerHook) {
+	samplerHook.Store(hook)
+}
+
+type sampler struct {
+	sink    string
+	options *SamplingOptions
+	mu      sync.Mutex
+	window  int64
+	counts  map[string]uint64 //当前tick内level+message的计数, 每个tick重置
+	dropped [zapcore.FatalLevel - zapcore.DebugLevel + 1]uint64
+}
+
+func newSampler(sink string, o *SamplingOptions) *sampler {
+	return &sampler{sink: sink, options: o, counts: make(map[string]uint64)}
+}
+
+func (s *sampler) sample(entry zapcore.Entry) bool {
+	if entry.Level > s.options.maxLevel {
+		return true
+	}
+	window := entry.Time.UnixNano() / int64(s.options.Tick)
+	key := entry.Level.String() + "\x00" + entry.Message
+	s.mu.Lock()
+	if window != s.window {
+		s.window = window
+		s.counts = make(map[string]uint64)
+	}
+	s.counts[key]++
+	n := s.counts[key]
+	s.mu.Unlock()
+
+	initial := uint64(s.options.Initial)
+	if n <= initial {
+		return true
+	}
+	if s.options.Thereafter > 0 && (n-initial)%uint64(s.options.Thereafter) == 0 {
+		return true
+	}
+	if entry.Level >= zapcore.DebugLevel && entry.Level <= zapcore.FatalLevel {
+		atomic.AddUint64(&s.dropped[entry.Level-zapcore.DebugLevel], 1)
+	}
+	if hook, ok := samplerHook.Load().(SamplerHook); ok && hook != nil {
+		hook(s.sink, entry)
+	}
+	return false
+}
+
+func (s *sampler) droppedCounts() map[string]uint64 {
+	counts := make(map[string]uint64)
+	for i := range s.dropped {
+		if n := atomic.LoadUint64(&s.dropped[i]); n > 0 {
+			counts[(zapcore.DebugLevel + zapcore.Level(i)).String()] = n
+		}
+	}
+	return counts
+}
+
+//按sink采样的core, With创建的子core共享计数
+type samplerCore struct {
+	zapcore.Core
+	sampler *sampler
+}
+
+func (c *samplerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &samplerCore{Core: c.Core.With(fields), sampler: c.sampler}
+}
+
+func (c *samplerCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(entry.Level) {
+		return ce
+	}
+	if !c.sampler.sample(entry) {
+		return ce
+	}
+	return c.Core.Check(entry, ce)
+}
+
+//各sink被采样丢弃的日志数量
+type Sampling struct {
+	mu       sync.RWMutex
+	sinks    []string
+	samplers map[string]*sampler
+}
+
+func newSampling() *Sampling {
+	return &Sampling{samplers: make(map[string]*sampler)}
+}
+
+func (s *Sampling) add(sampler *sampler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.samplers[sampler.sink]; !ok {
+		s.sinks = append(s.sinks, sampler.sink)
+	}
+	s.samplers[sampler.sink] = sampler
+}
+
+//sink -> level -> 丢弃数量, 只包含开启采样的sink
+func (s *Sampling) Dropped() map[string]map[string]uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	dropped := make(map[string]map[string]uint64, len(s.samplers))
+	for _, sink := range s.sinks {
+		dropped[sink] = s.samplers[sink].droppedCounts()
+	}
+	return dropped
+}
+
+//GET: 查询各sink被采样丢弃的日志数量
+func (s *Sampling) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not support"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Dropped())
+}
+
+var globalSampling = newSampling()
+
+//最近一次New创建的logger的采样统计
+func GlobalSampling() *Sampling {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return globalSampling
+}
+
+func replaceGlobalSampling(sampling *Sampling) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	globalSampling = sampling
+}
@@ -0,0 +1,145 @@
+package zaplog
+
+import (
+	"encoding/json"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var sampleTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+//直接调用core的Check与Write, 使用固定的entry时间, 不受tick边界影响
+func writeSampled(core zapcore.Core, level zapcore.Level, msg string, at time.Time, n int) {
+	for i := 0; i < n; i++ {
+		entry := zapcore.Entry{Level: level, Message: msg, Time: at}
+		if ce := core.Check(entry, nil); ce != nil {
+			ce.Write(zapcore.Field{Key: "i", Type: zapcore.Int64Type, Integer: int64(i + 1)})
+		}
+	}
+}
+
+func newTestSampler(initial, thereafter int) (*sampler, zapcore.Core, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	s := newSampler("app.log", &SamplingOptions{Tick: time.Second, Initial: initial, Thereafter: thereafter, maxLevel: zapcore.InfoLevel})
+	return s, &samplerCore{Core: core, sampler: s}, logs
+}
+
+func passed(logs *observer.ObservedLogs) []int64 {
+	var indexes []int64
+	for _, entry := range logs.AllUntimed() {
+		indexes = append(indexes, entry.ContextMap()["i"].(int64))
+	}
+	return indexes
+}
+
+func TestSamplerInitialThereafter(t *testing.T) {
+	s, core, logs := newTestSampler(2, 3)
+	writeSampled(core, zapcore.InfoLevel, "same", sampleTime, 10)
+	if indexes := passed(logs); !reflect.DeepEqual(indexes, []int64{1, 2, 5, 8}) {
+		t.Fatalf("expect first 2 and every 3rd entry passed, but got %v", indexes)
+	}
+	if dropped := s.droppedCounts(); !reflect.DeepEqual(dropped, map[string]uint64{"info": 6}) {
+		t.Fatalf("expect 6 info dropped, but got %v", dropped)
+	}
+}
+
+func TestSamplerThereafterZero(t *testing.T) {
+	s, core, logs := newTestSampler(3, 0)
+	writeSampled(core, zapcore.DebugLevel, "same", sampleTime, 10)
+	if indexes := passed(logs); !reflect.DeepEqual(indexes, []int64{1, 2, 3}) {
+		t.Fatalf("expect only initial entries passed, but got %v", indexes)
+	}
+	if dropped := s.droppedCounts(); !reflect.DeepEqual(dropped, map[string]uint64{"debug": 7}) {
+		t.Fatalf("expect 7 debug dropped, but got %v", dropped)
+	}
+}
+
+func TestSamplerPerLevelAndMessage(t *testing.T) {
+	s, core, logs := newTestSampler(1, 0)
+	writeSampled(core, zapcore.InfoLevel, "a", sampleTime, 3)
+	writeSampled(core, zapcore.InfoLevel, "b", sampleTime, 3)
+	writeSampled(core, zapcore.DebugLevel, "a", sampleTime, 3)
+	//高于MaxLevel不采样
+	writeSampled(core, zapcore.WarnLevel, "a", sampleTime, 3)
+	writeSampled(core, zapcore.ErrorLevel, "a", sampleTime, 3)
+
+	counts := map[string]int{}
+	for _, entry := range logs.AllUntimed() {
+		counts[entry.Level.String()+":"+entry.Message]++
+	}
+	expected := map[string]int{"info:a": 1, "info:b": 1, "debug:a": 1, "warn:a": 3, "error:a": 3}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expect %v, but got %v", expected, counts)
+	}
+	if dropped := s.droppedCounts(); !reflect.DeepEqual(dropped, map[string]uint64{"info": 4, "debug": 2}) {
+		t.Fatalf("expect 4 info and 2 debug dropped, but got %v", dropped)
+	}
+}
+
+func TestSamplerTickReset(t *testing.T) {
+	s, core, logs := newTestSampler(1, 0)
+	writeSampled(core, zapcore.InfoLevel, "same", sampleTime, 3)
+	writeSampled(core, zapcore.InfoLevel, "same", sampleTime.Add(time.Second), 3)
+	if logs.Len() != 2 {
+		t.Fatalf("expect 1 entry passed in each tick, but got %d", logs.Len())
+	}
+	if dropped := s.droppedCounts(); dropped["info"] != 4 {
+		t.Fatalf("expect 4 info dropped, but got %v", dropped)
+	}
+}
+
+func TestSamplerWithSharesCounts(t *testing.T) {
+	s, core, logs := newTestSampler(1, 0)
+	writeSampled(core, zapcore.InfoLevel, "same", sampleTime, 1)
+	writeSampled(core.With([]zapcore.Field{{Key: "k", Type: zapcore.StringType, String: "v"}}), zapcore.InfoLevel, "same", sampleTime, 2)
+	if logs.Len() != 1 || s.droppedCounts()["info"] != 2 {
+		t.Fatalf("expect child core share counts, but got %d passed %v dropped", logs.Len(), s.droppedCounts())
+	}
+}
+
+func TestSamplerHook(t *testing.T) {
+	defer SetSamplerHook(nil)
+	var sinks []string
+	SetSamplerHook(func(sink string, entry zapcore.Entry) {
+		sinks = append(sinks, sink+":"+entry.Message)
+	})
+	_, core, _ := newTestSampler(1, 0)
+	writeSampled(core, zapcore.InfoLevel, "same", sampleTime, 3)
+	if !reflect.DeepEqual(sinks, []string{"app.log:same", "app.log:same"}) {
+		t.Fatalf("expect hook called for each dropped entry, but got %v", sinks)
+	}
+}
+
+func TestSamplingDropped(t *testing.T) {
+	sampling := newSampling()
+	s1, core1, _ := newTestSampler(1, 0)
+	s2 := newSampler("stdout", &SamplingOptions{Tick: time.Second, Initial: 1, maxLevel: zapcore.InfoLevel})
+	sampling.add(s1)
+	sampling.add(s2)
+	writeSampled(core1, zapcore.InfoLevel, "same", sampleTime, 4)
+
+	expected := map[string]map[string]uint64{"app.log": {"info": 3}, "stdout": {}}
+	if dropped := sampling.Dropped(); !reflect.DeepEqual(dropped, expected) {
+		t.Fatalf("expect %v, but got %v", expected, dropped)
+	}
+
+	w := httptest.NewRecorder()
+	sampling.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logsampling", nil))
+	var body map[string]map[string]uint64
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(body, expected) {
+		t.Fatalf("expect 200 %v, but got %d %s", expected, w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	sampling.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/logsampling", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expect 405, but got %d", w.Code)
+	}
+}
@@ -5,30 +5,44 @@ import (
 	"fmt"
 	"github.com/asaskevich/govalidator"
 	"github.com/google/wire"
+	"github.com/liuliliujian/go-infra-com/buildinfo"
 	"github.com/liuliliujian/go-infra-com/config"
 	"github.com/natefinch/lumberjack"
-	errs "github.com/pkg/errors"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"os"
-	"runtime"
 	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 type Options struct {
 	Options []Option
 	AppName string
+	Mask    *MaskOptions //zap-mask, 对所有sink生效
+	config  config.Config //用于监听zap-logs的变更
 }
 
 type Option struct {
-	FilePath   string
-	MaxSize    int
-	MaxBackups int
-	MaxAge     int
-	Level      string
-	Lv         zapcore.Level
+	Name       string        //sink名称, 用于运行时调整级别, 默认为FilePath
+	FilePath   string        `required:"true"`
+	MaxSize    int           `min:"0"`
+	MaxBackups int           `min:"0"`
+	MaxAge     int           `min:"0"`
+	Level      string        `default:"info" oneof:"debug info warn error dpanic panic fatal"`
+	Lv         zapcore.Level `mapstructure:"-"` //由Level解析
+	Encoder    string        //json, console, logfmt或RegisterEncoder注册的名称, 默认文件为json, stdout/stderr为console
+	Keys       *EncoderKeys  //覆盖time, level, name, caller, message, stacktrace的字段名
+	TimeFormat string        //rfc3339, rfc3339nano, iso8601, epoch, epochmillis, epochnanos或go的时间layout
+	UTC        bool
+	Caller     string           `oneof:"function short full"` //默认function
+	Sampling   *SamplingOptions //默认开启, 只采样info及以下级别
+}
+
+func init() {
+	config.RegisterSchema("zap-logs", []Option{})
 }
 
 func NewOptions(c config.Config) (*Options, error) {
@@ -36,15 +50,20 @@ func NewOptions(c config.Config) (*Options, error) {
 		o = Options{Options: make([]Option, 0, 3)}
 	)
 
-	if err := c.UnmarshalKey("zap-logs", &o.Options); err != nil {
-		return nil, errs.WithMessage(err, "invalid zap log config options")
+	if err := config.Bind(c, "zap-logs", &o.Options); err != nil {
+		return nil, err
 	}
 
+	names := make(map[string]bool)
 	for idx, _ := range o.Options {
 		option := &o.Options[idx]
-		if option.FilePath == "" {
-			return nil, errors.New("log file path cannot be empty")
+		if option.Name == "" {
+			option.Name = option.FilePath
 		}
+		if names[option.Name] {
+			return nil, errors.New(fmt.Sprintf("log sink name[%s] is duplicated", option.Name))
+		}
+		names[option.Name] = true
 		if option.FilePath != "stdout" && option.FilePath != "stderr" {
 			fpath := option.FilePath
 			if strings.HasPrefix(fpath, ".") {
@@ -59,8 +78,23 @@ func NewOptions(c config.Config) (*Options, error) {
 			return nil, errors.New(fmt.Sprintf("log level[%s] is invalid", option.Level))
 		}
 		option.Lv = lv
+		if option.Encoder != "" && !hasEncoder(option.Encoder) {
+			return nil, errors.New(fmt.Sprintf("log encoder[%s] of sink[%s] is not registered", option.Encoder, option.Name))
+		}
+		if _, err := timeEncoder(option.TimeFormat, option.UTC, isConsole(*option)); err != nil {
+			return nil, err
+		}
+		if err := option.Sampling.maxLevel.UnmarshalText([]byte(option.Sampling.MaxLevel)); err != nil {
+			return nil, errors.New(fmt.Sprintf("log sampling max level[%s] is invalid", option.Sampling.MaxLevel))
+		}
 	}
+	mask, err := newMaskOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	o.Mask = mask
 	o.AppName = config.GetApplicationName(c)
+	o.config = c
 	return &o, nil
 }
 
@@ -71,18 +105,22 @@ func New(o *Options) (*zap.Logger, error) {
 
 	var ew zapcore.WriteSyncer
 
+	levels := newLevels()
+	sampling := newSampling()
+	masker := newMasker(o.Mask)
 	cores := make([]zapcore.Core, 0, 5)
 	for _, option := range o.Options {
-		developmentEncoderConfig := zap.NewDevelopmentEncoderConfig()
-		//todo 临时添加，添加日志caller func，后面梳理，包括ProductionEncoder
-		developmentEncoderConfig.EncodeCaller = callerEncoder
+		level := zap.NewAtomicLevelAt(option.Lv)
+		levels.add(option.Name, level)
+		encoder, err := newEncoder(option)
+		if err != nil {
+			return nil, err
+		}
 		if option.FilePath == "stdout" {
-			ce := zapcore.NewConsoleEncoder(developmentEncoderConfig)
-			cores = append(cores, zapcore.NewCore(ce, zapcore.Lock(os.Stdout), zap.NewAtomicLevelAt(option.Lv)))
+			cores = append(cores, zapcore.NewCore(encoder, zapcore.Lock(consoleSyncer{os.Stdout}), level))
 		} else if option.FilePath == "stderr" {
-			ew = zapcore.Lock(os.Stderr)
-			ce := zapcore.NewConsoleEncoder(developmentEncoderConfig)
-			cores = append(cores, zapcore.NewCore(ce, ew, zap.NewAtomicLevelAt(option.Lv)))
+			ew = zapcore.Lock(consoleSyncer{os.Stderr})
+			cores = append(cores, zapcore.NewCore(encoder, ew, level))
 		} else {
 			fw := zapcore.AddSync(&lumberjack.Logger{
 				Filename:   option.FilePath,
@@ -91,54 +129,100 @@ func New(o *Options) (*zap.Logger, error) {
 				MaxAge:     option.MaxAge, // days
 				LocalTime:  true,
 			})
-			productionEncoderConfig := zap.NewProductionEncoderConfig()
-			//添加下划线前缀, 避免与biz fields重复
-			productionEncoderConfig.TimeKey = "_time"
-			productionEncoderConfig.LevelKey = "_level"
-			productionEncoderConfig.NameKey = "_logger"
-			productionEncoderConfig.CallerKey = "_caller"
-			productionEncoderConfig.MessageKey = "_msg"
-			productionEncoderConfig.StacktraceKey = "_stacktrace"
-			productionEncoderConfig.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-				enc.AppendString(t.Format("2006-01-02 15:04:05.000"))
-			}
-			je := zapcore.NewJSONEncoder(productionEncoderConfig)
-			cores = append(cores, zapcore.NewCore(je, fw, zap.NewAtomicLevelAt(option.Lv)))
+			cores = append(cores, zapcore.NewCore(encoder, fw, level))
+		}
+		//每个sink单独采样, 避免某个sink的采样影响其他sink
+		if option.Sampling != nil && !option.Sampling.Disabled {
+			s := newSampler(option.Name, option.Sampling)
+			sampling.add(s)
+			cores[len(cores)-1] = &samplerCore{Core: cores[len(cores)-1], sampler: s}
 		}
 	}
 
 	if ew == nil {
-		ew = zapcore.Lock(os.Stderr)
+		ew = zapcore.Lock(consoleSyncer{os.Stderr})
 	}
 
 	core := zapcore.NewTee(cores...)
+	if masker != nil {
+		core = &maskCore{Core: core, masker: masker}
+	}
+	resources := &resources{}
+	core = &closerCore{Core: core, resources: resources}
 
 	initialFields := make(map[string]interface{})
 	if o.AppName != "" {
 		initialFields["app"] = o.AppName
 	}
+	info := buildinfo.Get()
+	initialFields["version"] = info.Version
+	initialFields["commit"] = info.Commit
 
 	cfg := zap.Config{
 		Development:       false,
 		DisableCaller:     false,
 		DisableStacktrace: false,
-		Sampling: &zap.SamplingConfig{
-			Initial:    100,
-			Thereafter: 100,
-		},
-		InitialFields: initialFields,
+		InitialFields:     initialFields,
 	}
 
 	logger = zap.New(core, buildOptions(cfg, ew)...)
 	zap.ReplaceGlobals(logger)
+	config.SetLogger(logger) //配置加载和监听的日志输出到配置的sinks
+	replaceGlobalLevels(levels)
+	replaceGlobalSampling(sampling)
+	if o.config != nil {
+		resources.add(watchLevels(o.config, levels, logger))
+	}
 
 	return logger, nil
 }
 
-func callerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
-	funcName := runtime.FuncForPC(caller.PC).Name()
-	slashLastIdx := strings.LastIndex(funcName, "/")
-	enc.AppendString(strings.Join([]string{caller.TrimmedPath(), funcName[slashLastIdx + 1:]}, ":"))
+//Sync并释放New创建的资源(例如zap-logs的配置监听), logger不再使用时调用, 多次调用只释放一次
+func Close(logger *zap.Logger) error {
+	err := logger.Sync()
+	if c, ok := logger.Core().(*closerCore); ok {
+		c.resources.release()
+	}
+	return err
+}
+
+type resources struct {
+	once     sync.Once
+	releases []func()
+}
+
+func (r *resources) add(release func()) {
+	r.releases = append(r.releases, release)
+}
+
+func (r *resources) release() {
+	r.once.Do(func() {
+		for _, release := range r.releases {
+			release()
+		}
+	})
+}
+
+//logger的根core, With创建的子core共享同一份资源, 任一logger都可以Close
+type closerCore struct {
+	zapcore.Core
+	resources *resources
+}
+
+func (c *closerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &closerCore{Core: c.Core.With(fields), resources: c.resources}
+}
+
+//stdout/stderr为终端或管道时Sync会返回EINVAL/ENOTTY, 忽略以免shutdown时logger.Sync误报失败
+type consoleSyncer struct {
+	*os.File
+}
+
+func (s consoleSyncer) Sync() error {
+	if err := s.File.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTTY) {
+		return err
+	}
+	return nil
 }
 
 func buildOptions(cfg zap.Config, errSink zapcore.WriteSyncer) []zap.Option {
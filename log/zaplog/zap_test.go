@@ -0,0 +1,37 @@
+package zaplog
+
+import (
+	"github.com/liuliliujian/go-infra-com/config"
+	"testing"
+)
+
+//只记录Watch与取消
+type watchConfig struct {
+	config.Config
+	watching int
+}
+
+func (c *watchConfig) Watch(key string, fn config.WatchFunc) func() {
+	c.watching++
+	return func() {
+		c.watching--
+	}
+}
+
+func TestCloseReleasesLevelWatch(t *testing.T) {
+	c := &watchConfig{}
+	o := &Options{Options: []Option{{Name: "stderr", FilePath: "stderr"}}, config: c}
+	logger, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.watching != 1 {
+		t.Fatalf("expect zap-logs watched, but got %d watches", c.watching)
+	}
+	//With创建的logger共享资源
+	Close(logger.With())
+	Close(logger)
+	if c.watching != 0 {
+		t.Fatalf("expect watch released once, but got %d watches", c.watching)
+	}
+}
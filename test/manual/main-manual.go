@@ -4,6 +4,7 @@ import (
 	config2 "github.com/liuliliujian/go-infra-com/config"
 	"github.com/liuliliujian/go-infra-com/config/vipercfg"
 	"github.com/liuliliujian/go-infra-com/database/gormdb"
+	"github.com/liuliliujian/go-infra-com/health"
 	"github.com/liuliliujian/go-infra-com/log/zaplog"
 	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc"
 	"errors"
@@ -57,8 +58,10 @@ func main() {
 	logger.Named("test.main").Info("info named some message", zap.String("ki", "vi"))
 	logger.Info("gorm", )
 
+	healthOptions, err := health.NewOptions(config)
+	checkError(err)
 	gormOptions, err := gormdb.NewOptions(config, logger)
-	db, err := gormdb.New(gormOptions, logger)
+	db, err := gormdb.New(gormOptions, logger, health.NewRegistry(healthOptions))
 	checkError(err)
 	db.Exec("update car set price = price + ?", 1)
 
@@ -1,9 +1,19 @@
 package main
 
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/liuliliujian/go-infra-com/bootstrap"
+	"github.com/liuliliujian/go-infra-com/bootstrap/command"
+	"github.com/liuliliujian/go-infra-com/database/gormdb"
+	"os"
+)
+
+func NewShutdownHooks(db *gorm.DB) bootstrap.ShutdownHooks {
+	return bootstrap.ShutdownHooks{gormdb.NewShutdownHook(db)}
+}
+
 func main() {
-	app, err := BootstrapApp()
-	if err != nil {
-		panic(err)
-	}
-	app.WaitShutdown()
+	os.Exit(command.Execute(command.Options{
+		Serve: BootstrapApp,
+	}))
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/liuliliujian/go-infra-com/bootstrap"
 	"github.com/liuliliujian/go-infra-com/config/vipercfg"
 	"github.com/liuliliujian/go-infra-com/database/gormdb"
+	"github.com/liuliliujian/go-infra-com/health"
 	"github.com/liuliliujian/go-infra-com/log/zaplog"
 	"github.com/liuliliujian/go-infra-com/transport/http/ginhttp"
 	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc"
@@ -15,9 +16,11 @@ import (
 var providerSet = wire.NewSet(
 	vipercfg.ProviderSet,
 	zaplog.ProviderSet,
+	health.ProviderSet,
 	gormdb.ProviderSet,
 	microrpc.ProviderSet,
 	ginhttp.ProviderSet,
+	NewShutdownHooks, //没有需要关闭的资源时使用bootstrap.NoShutdownHooks
 	bootstrap.RunApp,
 	//bootstrap.RunHttpApp,
 	//bootstrap.RunRpcApp,
@@ -6,13 +6,14 @@
 package main
 
 import (
+	"github.com/google/wire"
 	"github.com/liuliliujian/go-infra-com/bootstrap"
 	"github.com/liuliliujian/go-infra-com/config/vipercfg"
 	"github.com/liuliliujian/go-infra-com/database/gormdb"
+	"github.com/liuliliujian/go-infra-com/health"
 	"github.com/liuliliujian/go-infra-com/log/zaplog"
 	"github.com/liuliliujian/go-infra-com/transport/http/ginhttp"
 	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc"
-	"github.com/google/wire"
 )
 
 // Injectors from wire.go:
@@ -30,12 +31,18 @@ func BootstrapApp() (*bootstrap.Application, error) {
 	if err != nil {
 		return nil, err
 	}
+	status := health.NewStatus()
 	ginhttpOptions, err := ginhttp.NewOptions(config)
 	if err != nil {
 		return nil, err
 	}
+	healthOptions, err := health.NewOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	registry := health.NewRegistry(healthOptions)
 	ginModuleConfigurer := _wireGinModuleConfigurerValue
-	engine, err := ginhttp.NewRouter(ginhttpOptions, logger, ginModuleConfigurer)
+	engine, err := ginhttp.NewRouter(ginhttpOptions, logger, status, registry, ginModuleConfigurer)
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +55,7 @@ func BootstrapApp() (*bootstrap.Application, error) {
 		return nil, err
 	}
 	microModuleConfigurer := _wireMicroModuleConfigurerValue
-	service, err := microrpc.NewService(microrpcOptions, logger, microModuleConfigurer)
+	service, err := microrpc.NewService(microrpcOptions, logger, microModuleConfigurer, registry)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +63,16 @@ func BootstrapApp() (*bootstrap.Application, error) {
 	if err != nil {
 		return nil, err
 	}
-	application, err := bootstrap.RunApp(config, logger, server, microrpcServer)
+	gormdbOptions, err := gormdb.NewOptions(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gormdb.New(gormdbOptions, logger, registry)
+	if err != nil {
+		return nil, err
+	}
+	shutdownHooks := NewShutdownHooks(db)
+	application, err := bootstrap.RunApp(config, logger, status, server, microrpcServer, shutdownHooks)
 	if err != nil {
 		return nil, err
 	}
@@ -70,4 +86,4 @@ var (
 
 // wire.go:
 
-var providerSet = wire.NewSet(vipercfg.ProviderSet, zaplog.ProviderSet, gormdb.ProviderSet, microrpc.ProviderSet, ginhttp.ProviderSet, bootstrap.RunApp)
+var providerSet = wire.NewSet(vipercfg.ProviderSet, zaplog.ProviderSet, health.ProviderSet, gormdb.ProviderSet, microrpc.ProviderSet, ginhttp.ProviderSet, NewShutdownHooks, bootstrap.RunApp)
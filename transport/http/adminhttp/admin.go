@@ -0,0 +1,176 @@
+package adminhttp
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/liuliliujian/go-infra-com/buildinfo"
+	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/log/zaplog"
+	"github.com/liuliliujian/go-infra-com/util/graceutil"
+	"github.com/liuliliujian/go-infra-com/util/stackutil"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+)
+
+const CONF_ADMIN = config.CONF_APP_PREF + ".admin"
+
+//运维管理端口, 与业务端口隔离, 未配置token时只允许监听loopback地址
+type Options struct {
+	Enabled bool
+	Bind    string `default:"127.0.0.1"`
+	Port    int    `default:"9190" min:"1" max:"59999"`
+	Token   string
+}
+
+func init() {
+	config.RegisterSchema(CONF_ADMIN, Options{})
+}
+
+func NewOptions(c config.Config) (*Options, error) {
+	o := &Options{}
+	if err := config.Bind(c, CONF_ADMIN, o); err != nil {
+		return nil, err
+	}
+	if !o.Enabled {
+		return o, nil
+	}
+	if o.Token == "" && !isLoopback(o.Bind) {
+		return nil, errors.New(fmt.Sprintf("admin server without token must bind loopback address, but got[%s]", o.Bind))
+	}
+	return o, nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type Server struct {
+	options    *Options
+	logger     *zap.Logger
+	config     config.Config
+	handler    http.Handler
+	httpServer *http.Server
+}
+
+func NewServer(o *Options, logger *zap.Logger, c config.Config) (*Server, error) {
+	s := &Server{
+		options: o,
+		logger:  logger,
+		config:  c,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/stack", s.stack)
+	mux.HandleFunc("/config", s.effectiveConfig)
+	mux.HandleFunc("/loglevel", s.logLevel)
+	mux.HandleFunc("/logsampling", s.logSampling)
+	mux.HandleFunc("/buildinfo", s.buildInfo)
+	s.handler = s.authenticate(mux)
+	return s, nil
+}
+
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	s.httpServer = &http.Server{
+		Addr:    net.JoinHostPort(s.options.Bind, fmt.Sprint(s.options.Port)),
+		Handler: s.handler,
+	}
+	s.logger.Info("starting admin http server...")
+	listener, err := graceutil.ListenContext(ctx, "tcp", s.httpServer.Addr)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("failed to start admin http server[%s]", s.httpServer.Addr), zap.Error(err))
+		return err
+	}
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("admin http server exited", zap.Error(err))
+		}
+	}()
+	s.logger.Info(fmt.Sprintf("succeed to start admin http server[%s]", s.httpServer.Addr))
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	if s.httpServer == nil {
+		return nil
+	}
+	s.logger.Info("stopping admin http server...")
+	ctx, cancelFunc := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelFunc()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.logger.Error("failed to stop admin http server")
+		return err
+	}
+	s.logger.Info("succeed to stop admin http server")
+	return nil
+}
+
+//支持 Authorization: Bearer <token> 或 X-Admin-Token: <token>
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.options.Token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Admin-Token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.options.Token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) stack(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(stackutil.Stacks())
+}
+
+//?sources=true时返回每个配置项的来源
+func (s *Server) effectiveConfig(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("sources") == "true" {
+		writeJSON(w, http.StatusOK, config.DisplaySources(s.config))
+		return
+	}
+	writeJSON(w, http.StatusOK, config.DisplaySettings(s.config))
+}
+
+func (s *Server) logLevel(w http.ResponseWriter, r *http.Request) {
+	zaplog.GlobalLevels().ServeHTTP(w, r)
+}
+
+func (s *Server) logSampling(w http.ResponseWriter, r *http.Request) {
+	zaplog.GlobalSampling().ServeHTTP(w, r)
+}
+
+func (s *Server) buildInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildinfo.Get())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
@@ -0,0 +1,46 @@
+package adminhttp
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"net"
+	"testing"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestStartHonorsContext(t *testing.T) {
+	o := &Options{Enabled: true, Bind: "127.0.0.1", Port: freePort(t)}
+	s, err := NewServer(o, zap.NewNop(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Start(ctx); err != context.Canceled {
+		t.Fatalf("expect canceled, but got %v", err)
+	}
+	addr := net.JoinHostPort(o.Bind, fmt.Sprint(o.Port))
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Fatal("expect port not bound after canceled start")
+	}
+	//取消后的启动不影响之后重新启动
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop(context.Background())
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -2,46 +2,37 @@ package ginhttp
 
 import (
 	"context"
+	"github.com/liuliliujian/go-infra-com/buildinfo"
 	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/health"
+	"github.com/liuliliujian/go-infra-com/log/zaplog"
 	"github.com/liuliliujian/go-infra-com/util/ginutil"
-	"errors"
+	"github.com/liuliliujian/go-infra-com/util/graceutil"
 	"fmt"
 	"github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
 	"github.com/google/wire"
-	errs "github.com/pkg/errors"
-	"github.com/thoas/go-funk"
 	"go.uber.org/zap"
-	"net"
 	"net/http"
 	"strings"
 	"time"
 )
 
 type Options struct {
-	Port int
-	Mode string
+	Port int    `default:"9090" min:"1" max:"59999"`
+	Mode string `default:"debug" oneof:"debug test release"`
 }
 
-var (
-	supportedModes = []string{gin.DebugMode, gin.TestMode, gin.ReleaseMode}
-)
+func init() {
+	config.RegisterSchema("gin", Options{})
+}
 
 func NewOptions(c config.Config) (*Options, error) {
-	o := &Options{
-		Port: 9090,
-		Mode: gin.DebugMode,
-	}
-	if err := c.UnmarshalKey("gin", o); err != nil {
-		return nil, errs.WithMessage(err, "invalid gin config options")
-	}
-	if o.Port <= 0 || o.Port >= 60000 {
-		return nil, errors.New("gin port must between (0, 60000)")
+	o := &Options{}
+	if err := config.Bind(c, "gin", o); err != nil {
+		return nil, err
 	}
 	o.Mode = strings.ToLower(o.Mode)
-	if !funk.ContainsString(supportedModes, o.Mode) {
-		return nil, errors.New(fmt.Sprintf("invalid gin mode[%v], only support:%v", o.Mode, supportedModes))
-	}
 	return o, nil
 }
 
@@ -52,12 +43,17 @@ type GinModuleConfigurer struct {
 	RouterConfigurer           RouterConfigurer
 }
 
-func NewRouter(o *Options, logger *zap.Logger, configurer GinModuleConfigurer) (*gin.Engine, error) {
+func NewRouter(o *Options, logger *zap.Logger, status *health.Status, checks *health.Registry, configurer GinModuleConfigurer) (*gin.Engine, error) {
 	gin.SetMode(o.Mode)
 	router := gin.New()
 	router.Use(gin.Recovery()) //确保ginzap模块有问题时的保障, 观察一段时间，如果没问题可以移除
-	router.Use(ginzap.Ginzap(logger, "2006-01-02 15:04:05", false))
-	router.Use(ginzap.RecoveryWithZap(logger, true))
+	router.Use(ContextLogger(logger))
+	router.Use(contextual(logger, func(logger *zap.Logger) gin.HandlerFunc {
+		return ginzap.Ginzap(logger, "2006-01-02 15:04:05", false)
+	}))
+	router.Use(contextual(logger, func(logger *zap.Logger) gin.HandlerFunc {
+		return ginzap.RecoveryWithZap(logger, true)
+	}))
 
 	if !configurer.OverrideDefaultMiddlewares {
 		//todo add built-in middlewares, for example auth, monitor
@@ -71,8 +67,37 @@ func NewRouter(o *Options, logger *zap.Logger, configurer GinModuleConfigurer) (
 	})
 
 	//for health check
+	live := func(context *gin.Context) {
+		if status.Live() {
+			context.JSON(http.StatusOK, gin.H{"status": health.STATUS_UP, "state": status.State().String()})
+		} else {
+			context.JSON(http.StatusServiceUnavailable, gin.H{"status": health.STATUS_DOWN, "state": status.State().String()})
+		}
+	}
+	//保留原有的纯文本响应, 兼容按body匹配OK的探针, 状态码与/health/live一致, ?verbose时返回json
 	router.GET("/health", func(context *gin.Context) {
-		context.String(http.StatusOK, "OK")
+		if _, verbose := context.GetQuery("verbose"); verbose {
+			live(context)
+			return
+		}
+		if status.Live() {
+			context.String(http.StatusOK, "OK")
+		} else {
+			context.String(http.StatusServiceUnavailable, health.STATUS_DOWN)
+		}
+	})
+	router.GET("/health/live", live)
+	router.GET("/health/ready", func(context *gin.Context) {
+		report := checks.Readiness(context.Request.Context(), status)
+		if report.Up() {
+			context.JSON(http.StatusOK, report)
+		} else {
+			context.JSON(http.StatusServiceUnavailable, report)
+		}
+	})
+
+	router.GET("/version", func(context *gin.Context) {
+		context.JSON(http.StatusOK, buildinfo.Get())
 	})
 
 	if configurer.RouterConfigurer != nil {
@@ -82,6 +107,38 @@ func NewRouter(o *Options, logger *zap.Logger, configurer GinModuleConfigurer) (
 	return router, nil
 }
 
+//从请求头解析request id、trace id、用户及调用方服务, 将带有这些字段的logger放入请求的context, 并在响应头中返回request id
+//认证等后续中间件可通过zaplog.WithContext追加字段, 例如解析token后的用户
+func ContextLogger(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		correlation := zaplog.Correlation{
+			RequestID:   c.GetHeader(zaplog.HEADER_REQUEST_ID),
+			TraceID:     c.GetHeader(zaplog.HEADER_TRACE_ID),
+			UserID:      c.GetHeader(zaplog.HEADER_USER_ID),
+			PeerService: c.GetHeader(zaplog.HEADER_FROM_SERVICE),
+		}
+		if correlation.RequestID == "" {
+			correlation.RequestID = zaplog.NewID()
+		}
+		if correlation.TraceID == "" {
+			correlation.TraceID = zaplog.ParseTraceparent(c.GetHeader(zaplog.HEADER_TRACEPARENT))
+		}
+		if correlation.TraceID == "" {
+			correlation.TraceID = correlation.RequestID
+		}
+		c.Header(zaplog.HEADER_REQUEST_ID, correlation.RequestID)
+		c.Request = c.Request.WithContext(zaplog.WithCorrelation(c.Request.Context(), logger, correlation))
+		c.Next()
+	}
+}
+
+//使用请求context中的logger创建中间件, 使ginzap的日志带上关联字段
+func contextual(logger *zap.Logger, middleware func(logger *zap.Logger) gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		middleware(zaplog.FromContextOr(c.Request.Context(), logger))(c)
+	}
+}
+
 type Server struct {
 	options    *Options
 	logger     *zap.Logger
@@ -97,7 +154,7 @@ func NewServer(o *Options, logger *zap.Logger, router *gin.Engine) (*Server, err
 	}, nil
 }
 
-func (s *Server) Start() error {
+func (s *Server) Start(ctx context.Context) error {
 	s.httpServer = &http.Server{
 		Addr:           fmt.Sprintf(":%d", s.options.Port),
 		Handler:        s.router,
@@ -107,7 +164,7 @@ func (s *Server) Start() error {
 	}
 	failChan := make(chan error, 1)
 	s.logger.Info("starting gin http server...")
-	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	listener, err := graceutil.ListenContext(ctx, "tcp", s.httpServer.Addr) //平滑升级时复用父进程的listener
 	if err != nil {
 		s.logger.Error(fmt.Sprintf("failed to start gin http server[%d]", s.options.Port), zap.Error(err))
 		return err
@@ -121,15 +178,21 @@ func (s *Server) Start() error {
 	select {
 	case err := <-failChan:
 		return err
+	case <-ctx.Done():
+		s.httpServer.Close()
+		return ctx.Err()
 	case <-time.After(1 * time.Second):
 		s.logger.Sugar().Infof("succeed to start gin http server[%d]", s.options.Port)
 	}
 	return nil
 }
 
-func (s *Server) Stop() error {
+func (s *Server) Stop(ctx context.Context) error {
+	if s.httpServer == nil {
+		return nil
+	}
 	s.logger.Info("stopping gin http server...")
-	ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancelFunc := context.WithTimeout(ctx, 5*time.Second)
 	defer cancelFunc()
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		s.logger.Error("failed to stop gin http server")
@@ -0,0 +1,54 @@
+package ginhttp
+
+import (
+	"encoding/json"
+	"github.com/liuliliujian/go-infra-com/health"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthFollowsLiveness(t *testing.T) {
+	status := health.NewStatus()
+	router, err := NewRouter(&Options{Mode: "test"}, zap.NewNop(), status, health.NewRegistry(&health.Options{}), GinModuleConfigurer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+	liveStatus := func(body string) string {
+		var report struct {
+			Status string
+		}
+		if err := json.Unmarshal([]byte(body), &report); err != nil {
+			t.Fatalf("expect json body, but got %s", body)
+		}
+		return report.Status
+	}
+
+	//兼容原有的纯文本响应
+	if code, body := get("/health"); code != http.StatusOK || body != "OK" {
+		t.Fatalf("expect /health 200 OK when starting, but got %d %s", code, body)
+	}
+	for _, path := range []string{"/health/live", "/health?verbose"} {
+		if code, body := get(path); code != http.StatusOK || liveStatus(body) != health.STATUS_UP {
+			t.Fatalf("expect %s 200 UP when starting, but got %d %s", path, code, body)
+		}
+	}
+
+	if err := status.Transit(health.StateStopped); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := get("/health"); code != http.StatusServiceUnavailable || body != health.STATUS_DOWN {
+		t.Fatalf("expect /health 503 DOWN when stopped, but got %d %s", code, body)
+	}
+	for _, path := range []string{"/health/live", "/health?verbose=true"} {
+		if code, body := get(path); code != http.StatusServiceUnavailable || liveStatus(body) != health.STATUS_DOWN {
+			t.Fatalf("expect %s 503 DOWN when stopped, but got %d %s", path, code, body)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package microrpc
 
 import (
 	"context"
+	"github.com/liuliliujian/go-infra-com/buildinfo"
 	"github.com/liuliliujian/go-infra-com/config"
+	"github.com/liuliliujian/go-infra-com/health"
+	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc/middleware/logctx"
 	"github.com/liuliliujian/go-infra-com/transport/rpc/microrpc/middleware/logerr"
 	"github.com/liuliliujian/go-infra-com/util/syncutil"
 	"errors"
@@ -10,17 +13,19 @@ import (
 	"github.com/google/wire"
 	"github.com/micro/cli"
 	"github.com/micro/go-micro"
+	"github.com/micro/go-micro/broker"
 	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/config/cmd"
 	merrs "github.com/micro/go-micro/errors"
 	"github.com/micro/go-micro/metadata"
 	"github.com/micro/go-micro/registry"
 	"github.com/micro/go-micro/registry/etcd"
+	"github.com/micro/go-micro/registry/memory"
 	"github.com/micro/go-micro/server"
 	"github.com/micro/go-micro/transport"
+	tmemory "github.com/micro/go-micro/transport/memory"
 	"github.com/micro/go-micro/util/log"
 	"github.com/micro/go-plugins/wrapper/select/roundrobin"
-	errs "github.com/pkg/errors"
-	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 	"strings"
 	"sync"
@@ -29,14 +34,18 @@ import (
 
 const (
 	Registry_Prefix_Etcd = "etcd://"
+	Registry_Memory      = "memory" //进程内注册中心, 用于测试
+	Transport_Http       = "http"
+	Transport_Memory     = "memory" //进程内transport, 用于测试
 )
 
 type Options struct {
-	Name     string
-	Registry string
-	Metadata map[string]string
-	Server   *ServerOptions
-	Client   *ClientOptions
+	Name      string `required:"true"`
+	Registry  string `required:"true"`
+	Transport string `default:"http" oneof:"http memory"`
+	Metadata  map[string]string
+	Server    *ServerOptions
+	Client    *ClientOptions
 	//下面字段放这很尴尬, 先这样吧
 	StartChan chan error
 	StopFunc  context.CancelFunc
@@ -44,34 +53,38 @@ type Options struct {
 }
 
 type ServerOptions struct {
-	RegisterTTL      time.Duration
-	RegisterInterval time.Duration
+	RegisterTTL      time.Duration `default:"30s" min:"10s"`
+	RegisterInterval time.Duration `default:"15s" min:"5s"` //不能超过RegisterTTL的一半
 	LogError         bool
 }
 
 type ClientOptions struct {
-	RequestTimeout time.Duration
-	DialTimeout    time.Duration
-	Retries        int
-	Loadbalance    string
+	RequestTimeout time.Duration `default:"10s" min:"1ms"`
+	DialTimeout    time.Duration `default:"10s" min:"1ms"`
+	Retries        int           `default:"3" min:"0" max:"7"`
+	Loadbalance    string        `default:"random" oneof:"random roundrobin"`
 	LogError       bool
 }
 
+func init() {
+	config.RegisterSchema("micro", Options{})
+}
+
 func NewOptions(c config.Config, logger *zap.Logger) (*Options, error) {
 	o := &Options{
 		Name: config.GetApplicationName(c),
 	}
 
-	if err := c.UnmarshalKey("micro", o); err != nil {
-		return nil, errs.WithMessage(err, "invalid micro service config options")
+	if err := config.Bind(c, "micro", o); err != nil {
+		return nil, err
 	}
-
-	if o.Name == "" {
-		return nil, errors.New("micro service's name is required")
-	}
-
-	if o.Registry == "" {
-		return nil, errors.New("micro service's registry is required")
+	o.Transport = strings.ToLower(o.Transport)
+	o.Client.Loadbalance = strings.ToLower(o.Client.Loadbalance)
+	if o.Server.RegisterInterval > o.Server.RegisterTTL/2 {
+		return nil, &config.BindError{Key: "micro", Fields: []config.FieldError{{
+			Key:     "micro.server.registerInterval",
+			Message: fmt.Sprintf("must be <= half of micro.server.registerTTL(%v), but got %v", o.Server.RegisterTTL, o.Server.RegisterInterval),
+		}}}
 	}
 
 	o.StartChan = make(chan error, 1)
@@ -91,32 +104,21 @@ type ExtendHandlerWrappers func([]server.HandlerWrapper) []server.HandlerWrapper
 type ExtendClientWrappers func([]client.Wrapper) []client.Wrapper
 type ExtendCallWrappers func([]client.CallWrapper) []client.CallWrapper
 
-func NewService(o *Options, logger *zap.Logger, configurer MicroModuleConfigurer) (micro.Service, error) {
+func NewService(o *Options, logger *zap.Logger, configurer MicroModuleConfigurer, checks *health.Registry) (micro.Service, error) {
 	log.SetLogger(microzap{logger})
 
 	options := make([]micro.Option, 0, 10)
+	//不使用micro的全局server/broker, 同一进程可创建多个service, 必须在其他server options之前
+	options = append(options, micro.Server(server.NewServer()))
+	options = append(options, micro.Broker(broker.NewBroker()))
 	options = append(options, micro.Name(o.Name))
 
 	//start client options, must before some micro options, e.g. micro.registry
 	clientOptions := make([]client.Option, 0, 10)
-	requestTimeout := 10 * time.Second
-	if o.Client != nil && o.Client.RequestTimeout > 0 {
-		requestTimeout = o.Client.RequestTimeout
-	}
-	clientOptions = append(clientOptions, client.RequestTimeout(requestTimeout))
-
-	dialTimeout := 10 * time.Second
-	if o.Client != nil && o.Client.DialTimeout > 0 {
-		dialTimeout = o.Client.DialTimeout
-	}
-	clientOptions = append(clientOptions, client.DialTimeout(dialTimeout))
-
+	clientOptions = append(clientOptions, client.RequestTimeout(o.Client.RequestTimeout))
+	clientOptions = append(clientOptions, client.DialTimeout(o.Client.DialTimeout))
 	clientOptions = append(clientOptions, client.Retry(retryOnConnError(logger)))
-	retries := 3
-	if o.Client != nil && o.Client.Retries > 0 && o.Client.Retries < 8 {
-		retries = o.Client.Retries
-	}
-	clientOptions = append(clientOptions, client.Retries(retries))
+	clientOptions = append(clientOptions, client.Retries(o.Client.Retries))
 
 	callWrappers := make([]client.CallWrapper, 0, 10)
 	callWrappers = append(callWrappers, recordRoutedNode())
@@ -128,10 +130,11 @@ func NewService(o *Options, logger *zap.Logger, configurer MicroModuleConfigurer
 	options = append(options, micro.Client(client.NewClient(clientOptions...)))
 
 	clientWrappers := make([]client.Wrapper, 0, 10)
-	if o.Client != nil && o.Client.Loadbalance == "roundrobin" {
+	clientWrappers = append(clientWrappers, logctx.NewClientWrapper(o.Name))
+	if o.Client.Loadbalance == "roundrobin" {
 		clientWrappers = append(clientWrappers, roundrobin.NewClientWrapper())
 	}
-	if o.Client != nil && o.Client.LogError {
+	if o.Client.LogError {
 		clientWrappers = append(clientWrappers, logerr.NewClientWrapper(logger))
 	}
 	if configurer.ClientWrappersExtender != nil {
@@ -148,31 +151,25 @@ func NewService(o *Options, logger *zap.Logger, configurer MicroModuleConfigurer
 				),
 			),
 		))
+	} else if o.Registry == Registry_Memory {
+		options = append(options, micro.Registry(memory.NewRegistry()))
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	o.StopFunc = cancel
 	options = append(options, micro.Context(ctx))
+	options = append(options, micro.HandleSignal(false)) //退出信号由bootstrap统一处理, 通过StopFunc停止
 
-	if len(o.Metadata) > 0 {
-		options = append(options, micro.Metadata(o.Metadata))
+	//构建信息与micro.metadata一起注册, 配置中的同名key优先
+	metadata := buildinfo.Get().Map()
+	for k, v := range o.Metadata {
+		metadata[k] = v
 	}
+	options = append(options, micro.Metadata(metadata))
 
 	//start server options
-	registerTTL := 30 * time.Second
-	if o.Server != nil && o.Server.RegisterTTL > 10*time.Second {
-		registerTTL = o.Server.RegisterTTL
-	}
-	options = append(options, micro.RegisterTTL(registerTTL))
-
-	registerInterval := 15 * time.Second
-	if o.Server != nil && o.Server.RegisterInterval > 5*time.Second {
-		registerInterval = o.Server.RegisterInterval
-	}
-	if registerInterval > registerTTL/2 {
-		registerInterval = registerTTL / 2
-	}
-	options = append(options, micro.RegisterInterval(registerInterval))
+	options = append(options, micro.RegisterTTL(o.Server.RegisterTTL))
+	options = append(options, micro.RegisterInterval(o.Server.RegisterInterval))
 
 	waitGroup := new(sync.WaitGroup)
 	handlerWrappers := make([]server.HandlerWrapper, 0, 10)
@@ -183,7 +180,8 @@ func NewService(o *Options, logger *zap.Logger, configurer MicroModuleConfigurer
 			return handlerFunc(ctx, req, rsp)
 		}
 	})
-	if o.Server != nil && o.Server.LogError {
+	handlerWrappers = append(handlerWrappers, logctx.NewHandlerWrapper(logger)) //必须在logerr之前
+	if o.Server.LogError {
 		handlerWrappers = append(handlerWrappers, logerr.NewHandlerWrapper(logger))
 	}
 	if configurer.HandlerWrappersExtender != nil {
@@ -201,24 +199,45 @@ func NewService(o *Options, logger *zap.Logger, configurer MicroModuleConfigurer
 	}))
 	//end server options
 
-	options = append(options, micro.Transport(transport.NewTransport(
-		transport.Timeout(20*time.Second),
-	)))
+	if o.Transport == Transport_Memory {
+		options = append(options, micro.Transport(tmemory.NewTransport(
+			transport.Timeout(20*time.Second),
+		)))
+	} else {
+		//http transport不支持传入listener, 平滑升级时rpc端口不被继承, 由注册中心切换, 见graceutil
+		options = append(options, micro.Transport(transport.NewTransport(
+			transport.Timeout(20*time.Second),
+		)))
+	}
 
-	//为使micro cli flag解析能正常通过，需要将所有flag适配到micro cli flag
-	flags := make([]cli.Flag, 0, 10)
-	pflag.VisitAll(func(flag *pflag.Flag) {
-		flags = append(flags, cli.StringFlag{
-			Name: flag.Name,
-		})
-	})
-	options = append(options, micro.Flags(flags...))
+	//命令行由bootstrap/command统一解析, micro不再解析os.Args
+	options = append(options, micro.Cmd(&noopCmd{app: cli.NewApp()}))
 
 	service := micro.NewService(options...)
 	service.Init()
+
+	//注册中心不可达时已建立的连接仍可用, 不影响readiness
+	err := checks.Register(health.Check{Name: "registry", Critical: false, Checker: registryChecker(o, service.Options().Registry)})
+	if err != nil {
+		return nil, err
+	}
 	return service, nil
 }
 
+func registryChecker(o *Options, r registry.Registry) health.CheckerFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		services, err := r.GetService(o.Name)
+		if err != nil && err != registry.ErrNotFound {
+			return map[string]interface{}{"registry": o.Registry}, err
+		}
+		nodes := 0
+		for _, service := range services {
+			nodes += len(service.Nodes)
+		}
+		return map[string]interface{}{"registry": o.Registry, "nodes": nodes}, nil
+	}
+}
+
 type Server struct {
 	logger  *zap.Logger
 	options *Options
@@ -238,7 +257,11 @@ func NewServer(o *Options, logger *zap.Logger, s micro.Service, configurer Micro
 	}, nil
 }
 
-func (s *Server) Start() error {
+func (s *Server) Service() micro.Service {
+	return s.service
+}
+
+func (s *Server) Start(ctx context.Context) error {
 	s.logger.Info("starting micro service server...")
 	failChan := make(chan error, 1)
 	go func() {
@@ -253,18 +276,22 @@ func (s *Server) Start() error {
 		s.logger.Info("succeed to start micro service server")
 	case err := <-failChan:
 		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	case <-time.After(waitTime):
 		return errors.New(fmt.Sprintf("timeout(%v) waiting for micro service server to start", waitTime))
 	}
 	return nil
 }
 
-func (s *Server) Stop() error {
+func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Info("stopping micro service server...")
 	s.options.StopFunc()
 	waitTime := 8 * time.Second
 	select {
 	case <-s.options.StopChan:
+	case <-ctx.Done():
+		return ctx.Err()
 	case <-time.After(waitTime):
 		return errors.New(fmt.Sprintf("timeout(%v) waiting for micro service server to stop", waitTime))
 	}
@@ -272,6 +299,27 @@ func (s *Server) Stop() error {
 	return nil
 }
 
+//只接收options, 不解析命令行, 避免micro因未知flag或子命令退出
+type noopCmd struct {
+	app  *cli.App
+	opts cmd.Options
+}
+
+func (c *noopCmd) App() *cli.App {
+	return c.app
+}
+
+func (c *noopCmd) Init(opts ...cmd.Option) error {
+	for _, o := range opts {
+		o(&c.opts)
+	}
+	return nil
+}
+
+func (c *noopCmd) Options() cmd.Options {
+	return c.opts
+}
+
 type microzap struct {
 	*zap.Logger
 }
@@ -0,0 +1,33 @@
+package microrpc
+
+import (
+	"github.com/liuliliujian/go-infra-com/config/vipercfg"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+//只写了micro.client:/micro.server:时使用默认值, 不能panic
+func TestNewOptionsWithEmptySections(t *testing.T) {
+	c, err := vipercfg.NewFromSettings(map[string]interface{}{
+		"application": map[string]interface{}{"name": "demo"},
+		"micro": map[string]interface{}{
+			"registry": Registry_Memory,
+			"client":   nil,
+			"server":   nil,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := NewOptions(c, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Client == nil || o.Client.Loadbalance != "random" || o.Client.RequestTimeout != 10*time.Second {
+		t.Fatalf("expect default client options, but got %+v", o.Client)
+	}
+	if o.Server == nil || o.Server.RegisterTTL != 30*time.Second || o.Server.RegisterInterval != 15*time.Second {
+		t.Fatalf("expect default server options, but got %+v", o.Server)
+	}
+}
@@ -0,0 +1,93 @@
+package logctx
+
+import (
+	"context"
+	"github.com/liuliliujian/go-infra-com/log/zaplog"
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/metadata"
+	"github.com/micro/go-micro/server"
+	"go.uber.org/zap"
+	"strings"
+)
+
+/*
+	从metadata解析request id、trace id、用户及调用方服务, 将带有这些字段的logger放入handler的context
+	调用下游服务时传递trace id、用户及当前服务名, 使整条调用链的日志可以通过trace id关联
+*/
+func NewHandlerWrapper(logger *zap.Logger) server.HandlerWrapper {
+	return func(handlerFunc server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			md, _ := metadata.FromContext(ctx)
+			correlation := zaplog.Correlation{
+				RequestID:   get(md, zaplog.HEADER_REQUEST_ID),
+				TraceID:     get(md, zaplog.HEADER_TRACE_ID),
+				UserID:      get(md, zaplog.HEADER_USER_ID),
+				PeerService: get(md, zaplog.HEADER_FROM_SERVICE),
+			}
+			if correlation.RequestID == "" {
+				correlation.RequestID = zaplog.NewID()
+			}
+			if correlation.TraceID == "" {
+				correlation.TraceID = zaplog.ParseTraceparent(get(md, zaplog.HEADER_TRACEPARENT))
+			}
+			if correlation.TraceID == "" {
+				correlation.TraceID = correlation.RequestID
+			}
+			return handlerFunc(zaplog.WithCorrelation(ctx, logger, correlation), req, rsp)
+		}
+	}
+}
+
+//metadata经过http传输后key的大小写可能变化
+func get(md metadata.Metadata, key string) string {
+	if value, ok := md[key]; ok {
+		return value
+	}
+	for k, v := range md {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+type clientWrapper struct {
+	client.Client
+	service string
+}
+
+func (c *clientWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	md := metadata.Metadata{}
+	if correlation, ok := zaplog.CorrelationFrom(ctx); ok {
+		if correlation.TraceID != "" {
+			md[zaplog.HEADER_TRACE_ID] = correlation.TraceID
+		}
+		if correlation.UserID != "" {
+			md[zaplog.HEADER_USER_ID] = correlation.UserID
+		}
+	}
+	ctx = metadata.MergeContext(ctx, md, false)
+	return c.Client.Call(withFromService(ctx, c.service), req, rsp, opts...)
+}
+
+//handler的context中带有上游传入的X-From-Service(大小写可能不同), 必须覆盖为当前服务
+func withFromService(ctx context.Context, service string) context.Context {
+	md, _ := metadata.FromContext(ctx)
+	patched := metadata.Metadata{zaplog.HEADER_FROM_SERVICE: service}
+	for k, v := range md {
+		if !strings.EqualFold(k, zaplog.HEADER_FROM_SERVICE) {
+			patched[k] = v
+		}
+	}
+	return metadata.NewContext(ctx, patched)
+}
+
+//service为当前服务名, 下游服务日志中的peerService
+func NewClientWrapper(service string) client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &clientWrapper{
+			Client:  c,
+			service: service,
+		}
+	}
+}
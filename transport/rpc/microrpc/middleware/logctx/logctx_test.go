@@ -0,0 +1,52 @@
+package logctx
+
+import (
+	"context"
+	"github.com/liuliliujian/go-infra-com/log/zaplog"
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/metadata"
+	"github.com/micro/go-micro/server"
+	"go.uber.org/zap"
+	"testing"
+)
+
+type recordClient struct {
+	client.Client
+	md metadata.Metadata
+}
+
+func (c *recordClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	c.md, _ = metadata.FromContext(ctx)
+	return nil
+}
+
+//a -> b -> c, c收到的peerService应为b而不是a
+func TestClientOverwritesFromService(t *testing.T) {
+	recorder := &recordClient{}
+	downstream := NewClientWrapper("b")(recorder)
+	incoming := metadata.NewContext(context.Background(), metadata.Metadata{
+		"x-from-service":         "a",
+		zaplog.HEADER_TRACE_ID:   "t1",
+		zaplog.HEADER_REQUEST_ID: "r1",
+	})
+	handler := NewHandlerWrapper(zap.NewNop())(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		correlation, _ := zaplog.CorrelationFrom(ctx)
+		if correlation.PeerService != "a" {
+			t.Fatalf("expect peer service a, but got %s", correlation.PeerService)
+		}
+		return downstream.Call(ctx, nil, nil)
+	})
+	if err := handler(incoming, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if from := get(recorder.md, zaplog.HEADER_FROM_SERVICE); from != "b" {
+		t.Fatalf("expect from service b, but got %s", from)
+	}
+	if len(recorder.md) != 3 || recorder.md[zaplog.HEADER_TRACE_ID] != "t1" {
+		t.Fatalf("expect trace id propagated without duplicated from service, but got %v", recorder.md)
+	}
+	in, _ := metadata.FromContext(incoming)
+	if in["x-from-service"] != "a" {
+		t.Fatal("expect incoming metadata unchanged")
+	}
+}
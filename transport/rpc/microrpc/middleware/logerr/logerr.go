@@ -3,6 +3,7 @@ package logerr
 import (
 	"context"
 	"fmt"
+	"github.com/liuliliujian/go-infra-com/log/zaplog"
 	"github.com/micro/go-micro/client"
 	"github.com/micro/go-micro/server"
 	"go.uber.org/zap"
@@ -11,6 +12,7 @@ import (
 
 /*
 	micro service call调用出错打印日志，避免每次需要开发人员代码额外打印
+	优先使用context中的logger, 日志带有request id、trace id等关联字段
 */
 type clientWrapper struct {
 	client.Client
@@ -30,7 +32,7 @@ func (c *clientWrapper) Call(ctx context.Context, req client.Request, rsp interf
 		if len(fragments) > 1 {
 			method = fragments[1]
 		}
-		c.logger.Error(fmt.Sprintf("call micro service[%s:%s.%s] failed", service, handler, method), zap.Error(err))
+		zaplog.FromContextOr(ctx, c.logger).Error(fmt.Sprintf("call micro service[%s:%s.%s] failed", service, handler, method), zap.Error(err))
 	}
 	return err
 }
@@ -59,7 +61,7 @@ func NewHandlerWrapper(logger *zap.Logger) server.HandlerWrapper {
 				if len(fragments) > 1 {
 					method = fragments[1]
 				}
-				logger.Error(fmt.Sprintf("handle micro request[%s:%s.%s] failed", service, handler, method), zap.Error(err))
+				zaplog.FromContextOr(ctx, logger).Error(fmt.Sprintf("handle micro request[%s:%s.%s] failed", service, handler, method), zap.Error(err))
 			}
 			return err
 		}
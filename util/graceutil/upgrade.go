@@ -0,0 +1,263 @@
+package graceutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+	平滑升级: 父进程收到UpgradeSignal后fork-exec新的二进制, 通过ExtraFiles传递正在监听的socket,
+	子进程复用这些socket启动并通知ready后, 父进程关闭自身持有的listener并退出, 期间端口始终处于监听状态
+	只有通过Listen创建的listener会被传递; go-micro的http transport忽略listen option并自行net.Listen,
+	micro rpc server的listener不会被继承: 新进程监听新的随机端口并注册, 父进程退出时注销, rpc流量由注册中心切换,
+	切换期间客户端的节点缓存可能仍指向父进程, 依赖client重试; 因此micro server不能配置固定端口参与升级
+*/
+const (
+	UpgradeSignal = syscall.SIGUSR2
+
+	envInheritListeners = "INFRA_INHERIT_LISTENERS" //按fd顺序(从3开始)排列的listener key, 逗号分隔
+	envUpgradeReadyFd   = "INFRA_UPGRADE_READY_FD"  //子进程ready后写入一个字节
+)
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+type upgrader struct {
+	mu        sync.Mutex
+	parsed    bool
+	inherited map[string]*os.File
+	keys      []string
+	listeners map[string]net.Listener
+}
+
+var std = &upgrader{listeners: make(map[string]net.Listener)}
+
+func listenerKey(network, addr string) string {
+	return network + "://" + addr
+}
+
+//优先复用父进程传递的listener, 否则新建, 所有listener在升级时传递给子进程
+func Listen(network, addr string) (net.Listener, error) {
+	return std.listen(context.Background(), network, addr)
+}
+
+//ctx用于新建listener时的取消与超时, 例如组件的启动超时
+func ListenContext(ctx context.Context, network, addr string) (net.Listener, error) {
+	return std.listen(ctx, network, addr)
+}
+
+//是否由平滑升级启动的子进程
+func IsUpgrading() bool {
+	return os.Getenv(envUpgradeReadyFd) != ""
+}
+
+//子进程启动完成后调用, 通知父进程退出, 并关闭未被复用的listener
+func NotifyReady() error {
+	return std.notifyReady()
+}
+
+//fork-exec当前二进制并等待子进程ready, 失败时子进程被kill, 当前进程继续提供服务
+func Upgrade(timeout time.Duration) error {
+	return std.upgrade(timeout)
+}
+
+func (u *upgrader) parseInherited() {
+	if u.parsed {
+		return
+	}
+	u.parsed = true
+	u.inherited = make(map[string]*os.File)
+	value := os.Getenv(envInheritListeners)
+	if value == "" {
+		return
+	}
+	for i, key := range strings.Split(value, ",") {
+		u.inherited[key] = os.NewFile(uintptr(3+i), key)
+	}
+}
+
+func (u *upgrader) listen(ctx context.Context, network, addr string) (net.Listener, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.parseInherited()
+
+	key := listenerKey(network, addr)
+	if _, ok := u.listeners[key]; ok {
+		return nil, errors.New(fmt.Sprintf("listener[%s] already exists", key))
+	}
+	var (
+		listener net.Listener
+		err      error
+	)
+	if file, ok := u.inherited[key]; ok {
+		delete(u.inherited, key)
+		listener, err = net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("failed to inherit listener[%s]: %v", key, err))
+		}
+	} else {
+		listener, err = (&net.ListenConfig{}).Listen(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	u.listeners[key] = listener
+	u.keys = append(u.keys, key)
+	return &trackedListener{Listener: listener, key: key, upgrader: u}, nil
+}
+
+func (u *upgrader) remove(key string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.listeners, key)
+	for i, k := range u.keys {
+		if k == key {
+			u.keys = append(u.keys[:i], u.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (u *upgrader) notifyReady() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.parseInherited()
+	for key, file := range u.inherited {
+		file.Close()
+		delete(u.inherited, key)
+	}
+	os.Unsetenv(envInheritListeners)
+
+	value := os.Getenv(envUpgradeReadyFd)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(envUpgradeReadyFd)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid %s[%s]", envUpgradeReadyFd, value))
+	}
+	pipe := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer pipe.Close()
+	_, err = pipe.Write([]byte{1})
+	return err
+}
+
+func (u *upgrader) upgrade(timeout time.Duration) error {
+	u.mu.Lock()
+	keys := make([]string, 0, len(u.keys))
+	files := make([]*os.File, 0, len(u.keys)+1)
+	for _, key := range u.keys {
+		f, ok := u.listeners[key].(filer)
+		if !ok {
+			continue
+		}
+		file, err := f.File()
+		if err != nil {
+			u.mu.Unlock()
+			closeFiles(files)
+			return errors.New(fmt.Sprintf("failed to get file of listener[%s]: %v", key, err))
+		}
+		keys = append(keys, key)
+		files = append(files, file)
+	}
+	u.mu.Unlock()
+	defer closeFiles(files)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, envInheritListeners+"=") || strings.HasPrefix(kv, envUpgradeReadyFd+"=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	env = append(env, envInheritListeners+"="+strings.Join(keys, ","))
+	env = append(env, fmt.Sprintf("%s=%d", envUpgradeReadyFd, 3+len(files)))
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyWriter)
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to start new process: %v", err))
+	}
+
+	//子进程退出时pipe写端关闭, Read返回EOF
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := readyReader.Read(buf); err != nil {
+			ready <- errors.New(fmt.Sprintf("new process[%d] exited before ready: %v", cmd.Process.Pid, err))
+			return
+		}
+		ready <- nil
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(timeout):
+		err = errors.New(fmt.Sprintf("timeout(%v) waiting for new process[%d] to be ready", timeout, cmd.Process.Pid))
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
+
+//Close时从升级列表中移除
+type trackedListener struct {
+	net.Listener
+	key      string
+	upgrader *upgrader
+	once     sync.Once
+}
+
+func (l *trackedListener) Close() error {
+	l.once.Do(func() {
+		l.upgrader.remove(l.key)
+	})
+	return l.Listener.Close()
+}
+
+func (l *trackedListener) File() (*os.File, error) {
+	f, ok := l.Listener.(filer)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("listener[%s] does not support file", l.key))
+	}
+	return f.File()
+}
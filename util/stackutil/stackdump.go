@@ -42,7 +42,17 @@ func SetupStackDumper(logger logger) {
 }
 
 func dumpStacks(logger logger) {
+	logger.Print(fmt.Sprintf("=== BEGIN goroutine stack dump ===\n%s\n=== END goroutine stack dump ===", Stacks()))
+}
+
+//所有goroutine的堆栈, buffer不足时自动扩容
+func Stacks() []byte {
 	buf := make([]byte, 32768)
-	buf = buf[:runtime.Stack(buf, true)]
-	logger.Print(fmt.Sprintf("=== BEGIN goroutine stack dump ===\n%s\n=== END goroutine stack dump ===", buf))
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
 }